@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/JeffreyRichter/enum/enum"
+)
+
+// Scope of the token used to access Azure Storage
+const storageTokenScope = "https://storage.azure.com/.default"
+
+// ------------------------------------------------------------------
+// Authentication type
+type AuthType int
+
+var EAuthType = AuthType(0).INVALID_AUTH()
+
+func (AuthType) INVALID_AUTH() AuthType {
+	return AuthType(0)
+}
+
+func (AuthType) KEY() AuthType {
+	return AuthType(1)
+}
+
+func (AuthType) SAS() AuthType {
+	return AuthType(2)
+}
+
+func (AuthType) SPN() AuthType {
+	return AuthType(3)
+}
+
+func (AuthType) WORKLOAD_IDENTITY() AuthType {
+	return AuthType(4)
+}
+
+func (f AuthType) String() string {
+	return enum.StringInt(f, reflect.TypeOf(f))
+}
+
+func (a *AuthType) Parse(s string) error {
+	enumVal, err := enum.ParseInt(reflect.TypeOf(a), s, true, false)
+	if enumVal != nil {
+		*a = enumVal.(AuthType)
+	}
+
+	return err
+}
+
+// ------------------------------------------------------------------
+
+// selectAuthType : decide which credential to use based on what user has provided
+// Preference is given to user's choice, otherwise key, SAS, service principal and workload identity are tried in order
+func (c *StorageConfig) selectAuthType() error {
+	if c.AuthTypeStr != "" {
+		err := c.AuthType.Parse(c.AuthTypeStr)
+		if err != nil || c.AuthType == EAuthType.INVALID_AUTH() {
+			return fmt.Errorf("invalid auth type %s", c.AuthTypeStr)
+		}
+	} else if c.StorageAccountKey != "" {
+		c.AuthType = EAuthType.KEY()
+	} else if c.StorageAccountSAS != "" {
+		c.AuthType = EAuthType.SAS()
+	} else if c.ClientSecret != "" {
+		c.AuthType = EAuthType.SPN()
+	} else if c.FederatedTokenFile != "" {
+		c.AuthType = EAuthType.WORKLOAD_IDENTITY()
+	} else {
+		return fmt.Errorf("no usable credential found, set one of %s, %s, %s, %s (with %s / %s) or %s",
+			EnvAzStorageAccessKey, EnvAzStorageSAS, EnvAzStorageConnectionString,
+			EnvAzClientSecret, EnvAzTenantID, EnvAzClientID, EnvAzFederatedTokenFile)
+	}
+
+	// Validate that the chosen method has everything it needs
+	switch c.AuthType {
+	case EAuthType.KEY():
+		if c.StorageAccountName == "" || c.StorageAccountKey == "" {
+			return fmt.Errorf("key auth needs both %s and %s", EnvAzStorageAccount, EnvAzStorageAccessKey)
+		}
+	case EAuthType.SAS():
+		if c.StorageAccountSAS == "" {
+			return fmt.Errorf("sas auth needs %s", EnvAzStorageSAS)
+		}
+	case EAuthType.SPN():
+		if c.TenantID == "" || c.ClientID == "" || c.ClientSecret == "" {
+			return fmt.Errorf("spn auth needs %s, %s and %s", EnvAzTenantID, EnvAzClientID, EnvAzClientSecret)
+		}
+	case EAuthType.WORKLOAD_IDENTITY():
+		if c.TenantID == "" || c.ClientID == "" || c.FederatedTokenFile == "" {
+			return fmt.Errorf("workload identity auth needs %s, %s and %s", EnvAzTenantID, EnvAzClientID, EnvAzFederatedTokenFile)
+		}
+	}
+
+	if c.StorageAccountName == "" && len(c.ServiceEndpoints) == 0 {
+		return fmt.Errorf("storage account name not provided, set %s or --endpoint", EnvAzStorageAccount)
+	}
+
+	return nil
+}
+
+// readAuthParams : read credentials related environment variables, connection string fills account key or SAS
+func readAuthParams() error {
+	config.StorageAccountName = os.Getenv(EnvAzStorageAccount)
+	config.StorageAccountKey = os.Getenv(EnvAzStorageAccessKey)
+	config.StorageAccountSAS = os.Getenv(EnvAzStorageSAS)
+	config.TenantID = os.Getenv(EnvAzTenantID)
+	config.ClientID = os.Getenv(EnvAzClientID)
+	config.ClientSecret = os.Getenv(EnvAzClientSecret)
+	config.FederatedTokenFile = os.Getenv(EnvAzFederatedTokenFile)
+
+	if connStr := os.Getenv(EnvAzStorageConnectionString); connStr != "" {
+		if config.CustomEndpoint != "" {
+			return fmt.Errorf("%s can not be used along with custom endpoint", EnvAzStorageConnectionString)
+		}
+		config.CustomEndpoint = connStr
+	}
+
+	return nil
+}
+
+// getTokenCredential : create token credential for service principal or workload identity auth
+func (c *StorageConfig) getTokenCredential() (azcore.TokenCredential, error) {
+	switch c.AuthType {
+	case EAuthType.SPN():
+		return azidentity.NewClientSecretCredential(c.TenantID, c.ClientID, c.ClientSecret, nil)
+	case EAuthType.WORKLOAD_IDENTITY():
+		return azidentity.NewWorkloadIdentityCredential(&azidentity.WorkloadIdentityCredentialOptions{
+			TenantID:      c.TenantID,
+			ClientID:      c.ClientID,
+			TokenFilePath: c.FederatedTokenFile,
+		})
+	}
+
+	return nil, fmt.Errorf("auth type %s does not use token credential", c.AuthType)
+}
+
+// isTokenAuth : auth type needs a token credential
+func (c *StorageConfig) isTokenAuth() bool {
+	return c.AuthType == EAuthType.SPN() || c.AuthType == EAuthType.WORKLOAD_IDENTITY()
+}
+
+// describeAuthError : make connection test failure readable by telling which check failed and why
+func describeAuthError(c StorageConfig, check string, err error) error {
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) {
+		return fmt.Errorf("%s permission check failed using %s auth (status %d, code %s)",
+			check, c.AuthType, respErr.StatusCode, respErr.ErrorCode)
+	}
+
+	return fmt.Errorf("%s permission check failed using %s auth (%s)", check, c.AuthType, err.Error())
+}
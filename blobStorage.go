@@ -1,12 +1,16 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"fmt"
+	"io"
 	"path/filepath"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
@@ -20,33 +24,44 @@ type BlobStorage struct {
 }
 
 func (bs *BlobStorage) Init() error {
-	if bs.StorageAccountKey != "" {
+	var err error
+	containerURL := bs.getContainerURL(bs.StorageEndPoint)
+
+	switch bs.AuthType {
+	case EAuthType.KEY():
 		// Create credential object using storage account name and key
 		cred, err := azblob.NewSharedKeyCredential(bs.StorageAccountName, bs.StorageAccountKey)
 		if err != nil {
 			return err
 		}
 
-		containerURL := fmt.Sprintf("https://%s.%s.core.windows.net/%s", bs.StorageAccountName, bs.StorageEndPoint, bs.StorageAccountContainer)
 		bs.StorageClient, err = container.NewClientWithSharedKeyCredential(containerURL, cred, nil)
 		if err != nil {
 			return err
 		}
-	} else if bs.StorageAccountSAS != "" {
-		var err error
-		containerURL := fmt.Sprintf("https://%s.%s.core.windows.net/%s?%s", bs.StorageAccountName, bs.StorageEndPoint, bs.StorageAccountContainer, bs.StorageAccountSAS)
-		bs.StorageClient, err = container.NewClientWithNoCredential(containerURL, nil)
+	case EAuthType.SAS():
+		bs.StorageClient, err = container.NewClientWithNoCredential(fmt.Sprintf("%s?%s", containerURL, bs.StorageAccountSAS), nil)
 		if err != nil {
 			return err
 		}
-	} else {
-		fmt.Errorf("Invalid authentication config\n")
+	case EAuthType.SPN(), EAuthType.WORKLOAD_IDENTITY():
+		cred, err := bs.getTokenCredential()
+		if err != nil {
+			return err
+		}
+
+		bs.StorageClient, err = container.NewClient(containerURL, cred, nil)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid authentication config, no usable credential found")
 	}
 
 	return nil
 }
 
-func (bs *BlobStorage) TestConnection() error {
+func (bs *BlobStorage) TestConnection(ctx context.Context) error {
 	// Try to list the container and see if auth gets validated or not
 	maxResults := int32(2)
 	pager := bs.StorageClient.NewListBlobsHierarchyPager("/", &container.ListBlobsHierarchyOptions{
@@ -59,9 +74,9 @@ func (bs *BlobStorage) TestConnection() error {
 	}
 
 	for pager.More() {
-		_, err := pager.NextPage(context.TODO())
+		_, err := pager.NextPage(ctx)
 		if err != nil {
-			return err
+			return describeAuthError(bs.StorageConfig, "list", err)
 		}
 
 		// We are able to get some blobs so it means connection is successful
@@ -71,7 +86,7 @@ func (bs *BlobStorage) TestConnection() error {
 	return nil
 }
 
-func (bs *BlobStorage) UploadData(name string, data []byte, o *UploadOptions) error {
+func (bs *BlobStorage) UploadData(ctx context.Context, name string, data []byte, o *UploadOptions) error {
 	blockBlobClient := bs.StorageClient.NewBlockBlobClient(filepath.Join(bs.DestinationPath, name))
 
 	opts := &azblob.UploadBufferOptions{}
@@ -85,12 +100,66 @@ func (bs *BlobStorage) UploadData(name string, data []byte, o *UploadOptions) er
 		}
 	}
 
-	_, err := blockBlobClient.UploadBuffer(context.TODO(), data, opts)
+	_, err := blockBlobClient.UploadBuffer(ctx, data, opts)
 
 	return err
 }
 
-func (bs *BlobStorage) Delete(name string, o *DeleteOptions) error {
+// UploadStream : stage data block by block and then commit the block list, only one block is held in memory
+func (bs *BlobStorage) UploadStream(ctx context.Context, name string, r io.ReaderAt, size int64, o *UploadOptions) error {
+	blockBlobClient := bs.StorageClient.NewBlockBlobClient(filepath.Join(bs.DestinationPath, name))
+
+	blockCount := int64(1)
+	if bs.BlockSize > 0 {
+		blockCount = (size + bs.BlockSize - 1) / bs.BlockSize
+	}
+	if blockCount > blockblob.MaxBlocks {
+		return fmt.Errorf("%s needs %d blocks which is more than %d allowed, increase block size", name, blockCount, blockblob.MaxBlocks)
+	}
+
+	blockIDs := make([]string, 0, blockCount)
+	err := forEachBlock(r, size, bs.BlockSize, func(offset int64, data []byte) error {
+		// All block ids of a blob need to be of same length
+		id := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%016d", len(blockIDs))))
+		_, err := blockBlobClient.StageBlock(ctx, id, streaming.NopCloser(bytes.NewReader(data)), nil)
+		if err != nil {
+			return err
+		}
+
+		blockIDs = append(blockIDs, id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	opts := &blockblob.CommitBlockListOptions{}
+	if o != nil {
+		if o.MD5Sum != nil {
+			opts.HTTPHeaders = &blob.HTTPHeaders{BlobContentMD5: o.MD5Sum}
+		}
+		opts.Tier = o.Tier
+	}
+
+	_, err = blockBlobClient.CommitBlockList(ctx, blockIDs, opts)
+	return err
+}
+
+// DownloadData : read count bytes from offset, count of 0 reads till end of the blob
+func (bs *BlobStorage) DownloadData(ctx context.Context, name string, offset int64, count int64) ([]byte, error) {
+	blobClient := bs.StorageClient.NewBlobClient(filepath.Join(bs.DestinationPath, name))
+	resp, err := blobClient.DownloadStream(ctx, &blob.DownloadStreamOptions{
+		Range: blob.HTTPRange{Offset: offset, Count: count},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return io.ReadAll(resp.Body)
+}
+
+func (bs *BlobStorage) Delete(ctx context.Context, name string, o *DeleteOptions) error {
 	blockBlobClient := bs.StorageClient.NewBlockBlobClient(filepath.Join(bs.DestinationPath, name))
 
 	opts := &azblob.DeleteBlobOptions{}
@@ -98,20 +167,20 @@ func (bs *BlobStorage) Delete(name string, o *DeleteOptions) error {
 
 	}
 
-	_, err := blockBlobClient.Delete(context.TODO(), opts)
+	_, err := blockBlobClient.Delete(ctx, opts)
 
 	return err
 }
 
-func (bs *BlobStorage) SetTier(name string, tier blob.AccessTier) error {
+func (bs *BlobStorage) SetTier(ctx context.Context, name string, tier blob.AccessTier) error {
 	blockBlobClient := bs.StorageClient.NewBlockBlobClient(filepath.Join(bs.DestinationPath, name))
-	_, err := blockBlobClient.SetTier(context.TODO(), tier, nil)
+	_, err := blockBlobClient.SetTier(ctx, tier, nil)
 	return err
 }
 
-func (bs *BlobStorage) CreateStub(name string) error {
+func (bs *BlobStorage) CreateStub(ctx context.Context, name string) error {
 	blockBlobClient := bs.StorageClient.NewBlockBlobClient(filepath.Join(bs.DestinationPath, name))
-	_, err := blockBlobClient.UploadBuffer(context.TODO(), nil,
+	_, err := blockBlobClient.UploadBuffer(ctx, nil,
 		&blockblob.UploadBufferOptions{
 			Metadata: map[string]*string{"hdi_isfolder": to.Ptr("true")},
 			AccessConditions: &blob.AccessConditions{
@@ -133,7 +202,7 @@ func (bs *BlobStorage) ListBlobs(name string) *runtime.Pager[container.ListBlobs
 		Prefix: to.Ptr(listPath)})
 }
 
-func (bs *BlobStorage) GetProperties(name string) (blob.GetPropertiesResponse, error) {
+func (bs *BlobStorage) GetProperties(ctx context.Context, name string) (blob.GetPropertiesResponse, error) {
 	blockBlobClient := bs.StorageClient.NewBlockBlobClient(filepath.Join(bs.DestinationPath, name))
-	return blockBlobClient.GetProperties(context.TODO(), nil)
+	return blockBlobClient.GetProperties(ctx, nil)
 }
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
 )
 
 // ------------------------------------------------------------------
@@ -19,15 +23,78 @@ type kalpavrikshaConfig struct {
 	FileSize      int64 // Size of each file to be created
 	Parallelism   int   // Number of threads to run in parallel
 
+	FanoutStr        string  // Number of sub-directories per level in string e.g. 10,20,5
+	Fanout           []int64 // Number of sub-directories per level, overrides NumberOfDirs and DirDepth
+	FilesPerLevelStr string  // Number of files per directory at each level in string e.g. 0,5,100
+	FilesPerLevel    []int64 // Number of files per directory at each level, by default only leaves get NumberOfFiles
+	FanoutJitter     float64 // Fraction by which fan-out of each directory is randomised
+	EmptyDirRatio    float64 // Fraction of directories left empty
+
+	NameTemplateStr string        // Template for name of each file e.g. {dir}/{uuid}.{ext:csv,json}
+	NameTemplate    *nameTemplate // Compiled template for name of each file
+	NameTimeStr     string        // Time used by {time} token in string, RFC3339 or unix seconds
+	NameTime        time.Time     // Time used by {time} token
+
+	PrefixStrategyStr string         // Prefix strategy in string : None / Hash / Reverse / Shard / Hot
+	PrefixStrategy    PrefixStrategy // Prefix put in front of each generated path to pick its name range
+	PrefixLen         int            // Length of prefix for Hash and Reverse strategies
+	PrefixShards      int64          // Number of shards for Shard strategy
+
+	SizeDistStr string           // Distribution of file sizes in string e.g. lognormal:median=64KiB,sigma=1.5
+	SizeDist    sizeDistribution // Distribution from which size of each file is picked
+
 	InputTypeStr string     // Type of input in string : Zero / Rand / File
 	InputType    SourceType // Type of input : Zero / Rand / File
 
 	SourceFilePath string // In case of input is coming from a file, path to that file
+	Seed           int64  // Seed for random data, content of each file is derived from seed and its path
 	Tier           string // blob tier to set on upload
 
 	Delete  bool // Delete the previously generated data on given path
 	SetTier bool // Change Tier of previously generated data on given path
 
+	Verify       bool // Read back previously generated data and validate it against the data source
+	VerifyRanges int  // Number of ranges to validate per file, 0 validates the complete file
+
+	ManifestOutPath string // File where each object created by upload is recorded, CSV if it ends in .csv else JSONL
+	ManifestPath    string // Manifest of a previous run used as job source for delete, set-tier and verify
+
+	OpTimeout  time.Duration // Time allowed for each storage call, 0 means no limit
+	RunTimeout time.Duration // Time allowed for the complete run, 0 means no limit
+
+	JournalPath string // File where each completed work item is recorded
+	Resume      bool   // Skip items completed as per journal and retry failed ones
+
+	Read           bool        // Read back the data set to measure read throughput and latency
+	ReadPatternStr string      // How each file is read full / sequential / random
+	ReadPattern    ReadPattern // Parsed from ReadPatternStr
+	ReadSizeStr    string      // Size of each range read by sequential and random patterns
+	ReadSize       int64       // Parsed from ReadSizeStr
+	ReadCount      int         // Number of ranges read from each file by random pattern
+
+	Stat           bool        // Get properties and list over the data set to measure metadata calls
+	StatPatternStr string      // Order in which files are picked sequential / random / zipf
+	StatPattern    StatPattern // Parsed from StatPatternStr
+	StatZipf       float64     // Skew of zipf pattern, larger value concentrates calls on fewer files
+	StatList       float64     // Percentage of calls which list the directory of the file instead
+	StatOps        int64       // Calls in one pass of stat, 0 means one per file of the data set
+
+	MixStr string      // Weights of operations for mixed workload e.g. read=60,write=25,stat=10,delete=5
+	Mix    []mixWeight // Cumulative weights parsed from MixStr
+	MixOps int64       // Operations per pass of mixed workload, 0 means one per file of the data set
+
+	Duration        time.Duration // Time for which new work is started, passes over the data set are repeated till then
+	DurationModeStr string        // Whether passes after the first one create new objects or cycle over the same ones
+	DurationMode    DurationMode
+
+	OpsRate         float64 // Items started per second across all workers, 0 means no limit
+	Bandwidth       float64 // MB per second across all workers, 0 means no limit
+	WorkerOpsRate   float64 // Items started per second by each worker, 0 means no limit
+	WorkerBandwidth float64 // MB per second by each worker, 0 means no limit
+
+	ReportPath    string        // File where JSON report of the run is written, - for stdout
+	StatsInterval time.Duration // Interval at which operation stats are printed during the run, 0 prints only the final summary
+
 	CreateStub bool // Create directory stub files on the given path
 	DeleteStub bool // Delete directory stub files on the given path
 }
@@ -35,6 +102,7 @@ type kalpavrikshaConfig struct {
 type Kalpavriksha struct {
 	// Storage accoutn related config
 	storage Storage // Storage client
+	backend Storage // Storage client without stats, for calls which are not part of the workload
 
 	// Worker related internal objects
 	jobs      chan workItem  // Channel holding jobs to be performed
@@ -43,6 +111,31 @@ type Kalpavriksha struct {
 
 	// Data source provider
 	dataSrc dataSource // Source of data for input
+
+	// Record of objects created by upload
+	manifest *manifestWriter
+
+	// Record of completed work items to resume an interrupted run
+	journal *journal
+
+	// Cancelled when run is asked to stop, no new work is picked after that
+	stop context.Context
+
+	// Mixed workload over the data set, when --mix is given
+	mix *mixedWorkload
+
+	// Metadata workload over the data set, when --stat is given
+	stat *statWorkload
+
+	// Done when no new work should be started, either on stop or when --duration is over
+	window context.Context
+
+	// Latency and volume of every storage call
+	stats *statsCollector
+
+	// Number of items the task had to work on and how many of them ended in each status
+	itemsTotal int64
+	itemCounts map[JobStatusType]int64
 }
 
 // global variable holding all of the config
@@ -63,6 +156,150 @@ func sanitizeConfig() error {
 	}
 
 	config.FileSize = config.FileSize * 1024 * 1024
-	readStorageParams()
-	return nil
+	if config.SizeDistStr != "" {
+		config.SizeDist, err = parseSizeDistribution(config.SizeDistStr)
+		if err != nil {
+			return err
+		}
+	} else if config.FileSize < 0 {
+		// Negative value means generate a random number upto size and create file of that size
+		config.SizeDist = &uniformSize{min: 0, max: -config.FileSize - 1}
+	} else {
+		config.SizeDist = &fixedSize{size: config.FileSize}
+	}
+
+	_, fixed := config.SizeDist.(*fixedSize)
+	if config.InputType == ESourceType.FILE() && !fixed {
+		return fmt.Errorf("size distribution can not be used with FILE source type")
+	}
+
+	config.Fanout, err = parseLevelCounts(config.FanoutStr)
+	if err != nil {
+		return fmt.Errorf("invalid fanout : %s", err.Error())
+	}
+
+	config.FilesPerLevel, err = parseLevelCounts(config.FilesPerLevelStr)
+	if err != nil {
+		return fmt.Errorf("invalid files per level : %s", err.Error())
+	}
+
+	if len(config.FilesPerLevel) > 0 && !isTreeShape() {
+		return fmt.Errorf("files per level can only be used along with fanout")
+	}
+
+	if config.FanoutJitter < 0 || config.FanoutJitter > 1 || config.EmptyDirRatio < 0 || config.EmptyDirRatio > 1 {
+		return fmt.Errorf("fanout jitter and empty dir ratio should be between 0 and 1")
+	}
+
+	config.NameTemplate, err = parseNameTemplate(config.NameTemplateStr)
+	if err != nil {
+		return fmt.Errorf("invalid name template : %s", err.Error())
+	}
+
+	err = validatePrefixStrategy()
+	if err != nil {
+		return err
+	}
+
+	err = validateMix()
+	if err != nil {
+		return err
+	}
+
+	err = validateRead()
+	if err != nil {
+		return err
+	}
+
+	err = validateStat()
+	if err != nil {
+		return err
+	}
+
+	if config.NameTimeStr != "" {
+		config.NameTime, err = parseNameTime(config.NameTimeStr)
+		if err != nil {
+			return err
+		}
+	} else if config.NameTemplate.timed && (config.Delete || config.SetTier || config.Verify || config.Read || config.Stat || config.Resume || config.MixStr != "") && config.ManifestPath == "" {
+		return fmt.Errorf("name template with {time} needs the --name-time which was used to generate the data set")
+	} else {
+		config.NameTime = time.Now().UTC()
+	}
+
+	if config.ManifestPath != "" {
+		if isUploadTask() || config.CreateStub || config.DeleteStub {
+			return fmt.Errorf("manifest can only be used as job source for delete, set-tier, verify, read, stat or mix")
+		}
+
+		// Manifest is read once here so that a broken one is reported before any work starts
+		err = readManifest(config.ManifestPath, func(e *manifestEntry) {})
+		if err != nil {
+			return fmt.Errorf("invalid manifest : %s", err.Error())
+		}
+	}
+
+	if config.OpTimeout < 0 || config.RunTimeout < 0 {
+		return fmt.Errorf("timeouts can not be negative")
+	}
+
+	if config.OpsRate < 0 || config.Bandwidth < 0 || config.WorkerOpsRate < 0 || config.WorkerBandwidth < 0 {
+		return fmt.Errorf("rate limits can not be negative")
+	}
+
+	if isRateLimited() && (config.CreateStub || config.DeleteStub) {
+		return fmt.Errorf("rate limits are not supported with create-stub and delete-stub")
+	}
+
+	// Bandwidth is paced by the size of each item, which is not known up front for mix and is zero for metadata calls
+	if (config.Bandwidth > 0 || config.WorkerBandwidth > 0) && (config.Delete || config.SetTier || config.Stat || config.MixStr != "") {
+		return fmt.Errorf("bandwidth limit applies only to upload, verify and read, use --ops-rate instead")
+	}
+
+	if config.StatsInterval < 0 {
+		return fmt.Errorf("stats interval can not be negative")
+	}
+
+	if config.Resume && config.JournalPath == "" {
+		return fmt.Errorf("resume needs the --journal of the interrupted run")
+	}
+
+	if config.JournalPath != "" && (config.Verify || config.Read || config.Stat || config.MixStr != "" || config.CreateStub || config.DeleteStub) {
+		// Mix is a weighted random stream of operations, there is no completed item to resume from
+		return fmt.Errorf("journal can only be used for upload, delete or set-tier")
+	}
+
+	err = validateDuration()
+	if err != nil {
+		return err
+	}
+
+	// With a manifest paths come from it, only content needs the seed
+	seededLayout := isSeededLayout() && config.ManifestPath == ""
+
+	if config.Verify && config.Seed == 0 && (config.InputType == ESourceType.RANDOM() || !fixed || seededLayout) {
+		return fmt.Errorf("verify needs the --seed which was used to generate the data set")
+	}
+
+	if config.Resume && getTaskName() == "upload" && config.Seed == 0 && (config.InputType == ESourceType.RANDOM() || !fixed || seededLayout) {
+		// Rest of the data set has to be generated exactly as the interrupted run would have
+		return fmt.Errorf("resume needs the --seed which was used by the interrupted run")
+	}
+
+	if config.Read && config.Seed == 0 && config.ReadPattern != EReadPattern.FULL() && !fixed && config.ManifestPath == "" {
+		// Ranges are picked within the size each file was generated with
+		return fmt.Errorf("read pattern %s with varying file sizes needs the --seed which was used to generate the data set", config.ReadPattern)
+	}
+
+	if (config.Delete || config.SetTier || config.Read || config.Stat || config.MixStr != "") && config.Seed == 0 && seededLayout {
+		// Paths are derived from seed so without it a different set of paths would be generated
+		return fmt.Errorf("randomised tree shape, name template or prefix needs the --seed which was used to generate the data set")
+	}
+
+	config.BlockSize = config.BlockSize * 1024 * 1024
+	if config.BlockSize < 0 || config.BlockSize > blockblob.MaxStageBlockBytes {
+		return fmt.Errorf("block size should be between 0 and %d MB", blockblob.MaxStageBlockBytes/(1024*1024))
+	}
+
+	return readStorageParams()
 }
@@ -2,19 +2,25 @@ package main
 
 import (
 	"crypto/md5"
+	"encoding/binary"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"log"
-	"math"
-	"math/rand"
 	"os"
+	"sync"
 	"time"
 )
 
 // -------------------------------------------------------------------
 type dataSource interface {
 	Init(i interface{}) error
-	GetData() ([]byte, error)
+	GetData(name string) ([]byte, error)
 	GetMd5Sum(data []byte) []byte
+
+	// Expected size and content of a file, used to verify what was generated
+	GetSize(name string) int64
+	ReadAt(name string, buf []byte, offset int64)
 }
 
 func getMD5Sum(data []byte) []byte {
@@ -22,60 +28,164 @@ func getMD5Sum(data []byte) []byte {
 	return x[:]
 }
 
+// sourceReader : expose content of a file generated by data source as io.ReaderAt
+// Content is generated on demand so a file of any size can be streamed with bounded memory
+type sourceReader struct {
+	src  dataSource
+	name string
+	size int64
+}
+
+func newSourceReader(src dataSource, name string) *sourceReader {
+	return &sourceReader{src: src, name: name, size: src.GetSize(name)}
+}
+
+func (sr *sourceReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= sr.size {
+		return 0, io.EOF
+	}
+
+	n := int64(len(p))
+	if n > sr.size-off {
+		n = sr.size - off
+	}
+
+	sr.src.ReadAt(sr.name, p[:n], off)
+	if n < int64(len(p)) {
+		return int(n), io.EOF
+	}
+	return int(n), nil
+}
+
+// getStreamMD5Sum : MD5 Sum of the content read block by block
+func getStreamMD5Sum(r io.ReaderAt, size int64, blockSize int64) ([]byte, error) {
+	h := md5.New()
+	err := forEachBlock(r, size, blockSize, func(offset int64, data []byte) error {
+		_, err := h.Write(data)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// dataSizeConfig : size of generated files
+type dataSizeConfig struct {
+	dist sizeDistribution // Distribution from which size of each file is picked
+	seed int64            // Seed from which size (and content) of each file is derived
+}
+
+// GetSize : size of the given file, same for a given seed and name across runs
+func (c *dataSizeConfig) GetSize(name string) int64 {
+	return getFileSize(c.dist, c.seed, name)
+}
+
+// isFixedSize : all files are of same size
+func (c *dataSizeConfig) isFixedSize() bool {
+	_, ok := c.dist.(*fixedSize)
+	return ok
+}
+
 //-------------------------------------------------------------------
 
 type zeroDataSource struct {
-	size   int64
+	dataSizeConfig
 	md5sum []byte
 	data   []byte
+	once   sync.Once
 }
 
 func (zds *zeroDataSource) Init(i interface{}) error {
-	size := i.(int64)
-	zds.size = size
-	zds.data = make([]byte, size)
-	zds.md5sum = getMD5Sum(zds.data)
+	zds.dataSizeConfig = i.(dataSizeConfig)
 	return nil
 }
 
-func (zds *zeroDataSource) GetData() ([]byte, error) {
+func (zds *zeroDataSource) GetData(name string) ([]byte, error) {
+	if !zds.isFixedSize() {
+		return make([]byte, zds.GetSize(name)), nil
+	}
+
+	// All files share one buffer which is allocated on first use as streaming uploads never ask for complete data
+	zds.once.Do(func() {
+		zds.data = make([]byte, zds.GetSize(name))
+		zds.md5sum = getMD5Sum(zds.data)
+	})
 	return zds.data, nil
 }
 
 func (zds *zeroDataSource) GetMd5Sum(data []byte) []byte {
+	if !zds.isFixedSize() {
+		return getMD5Sum(data)
+	}
 	return zds.md5sum
 }
 
+func (zds *zeroDataSource) ReadAt(name string, buf []byte, offset int64) {
+	for i := range buf {
+		buf[i] = 0
+	}
+}
+
 // -------------------------------------------------------------------
-type randomDataSource struct {
-	size int64
+// Seeded data generation
+//
+// Content of a file is a pure function of (seed, path, offset) so any worker can regenerate
+// any range of any file at any time without keeping the generated data around.
+// Path here is the name of the file relative to destination path.
+
+// Increment of splitmix64 sequence
+const seedGamma uint64 = 0x9e3779b97f4a7c15
+
+func splitmix64(x uint64) uint64 {
+	x += seedGamma
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
 }
 
-func (rds *randomDataSource) Init(i interface{}) error {
-	rand.Seed(time.Now().UnixNano())
-	size := i.(int64)
-	rds.size = size
-	return nil
+// seededKey : key of the random stream of a file, derived from seed and its path
+func seededKey(seed int64, name string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return splitmix64(uint64(seed) ^ h.Sum64())
 }
 
-func (rds *randomDataSource) GetData() ([]byte, error) {
-	size := rds.size
-	if size < 0 {
-		// Negative value means generate a random number upto size and create file of that size
-		size = rand.Int63n(int64(math.Abs(float64(rds.size))))
-	}
+// fillSeededData : fill buf with content of the given file starting at offset
+// Each 8 byte word of the file is generated independently so data can be produced from any offset
+func fillSeededData(seed int64, name string, offset int64, buf []byte) {
+	key := seededKey(seed, name)
+	word := uint64(offset) / 8
+	skip := int(uint64(offset) % 8)
 
-	data := make([]byte, size)
-	n, err := rand.Read(data)
+	var tmp [8]byte
+	for i := 0; i < len(buf); word++ {
+		val := splitmix64(key + word*seedGamma)
+		if skip == 0 && len(buf)-i >= 8 {
+			binary.LittleEndian.PutUint64(buf[i:], val)
+			i += 8
+			continue
+		}
 
-	if err != nil {
-		return nil, err
+		binary.LittleEndian.PutUint64(tmp[:], val)
+		i += copy(buf[i:], tmp[skip:])
+		skip = 0
 	}
+}
 
-	if int64(n) != size {
-		return nil, fmt.Errorf("failed to generate data of size %v (generated only %v)", size, n)
-	}
+// -------------------------------------------------------------------
+type randomDataSource struct {
+	dataSizeConfig
+}
 
+func (rds *randomDataSource) Init(i interface{}) error {
+	rds.dataSizeConfig = i.(dataSizeConfig)
+	return nil
+}
+
+func (rds *randomDataSource) GetData(name string) ([]byte, error) {
+	data := make([]byte, rds.GetSize(name))
+	fillSeededData(rds.seed, name, 0, data)
 	return data, nil
 }
 
@@ -83,6 +193,10 @@ func (rds *randomDataSource) GetMd5Sum(data []byte) []byte {
 	return getMD5Sum(data)
 }
 
+func (rds *randomDataSource) ReadAt(name string, buf []byte, offset int64) {
+	fillSeededData(rds.seed, name, offset, buf)
+}
+
 // -------------------------------------------------------------------
 type fileDataSourceConfig struct {
 	filename string
@@ -118,7 +232,7 @@ func (fds *fileDataSource) Init(i interface{}) error {
 	return nil
 }
 
-func (fds *fileDataSource) GetData() ([]byte, error) {
+func (fds *fileDataSource) GetData(name string) ([]byte, error) {
 	return fds.data, nil
 }
 
@@ -126,12 +240,34 @@ func (fds *fileDataSource) GetMd5Sum(data []byte) []byte {
 	return fds.md5sum
 }
 
+func (fds *fileDataSource) GetSize(name string) int64 {
+	return fds.filesize
+}
+
+func (fds *fileDataSource) ReadAt(name string, buf []byte, offset int64) {
+	if offset < int64(len(fds.data)) {
+		copy(buf, fds.data[offset:])
+	}
+}
+
 //-------------------------------------------------------------------
 
 func createDataSource(t SourceType) (dataSource, error) {
+	if t != ESourceType.FILE() {
+		if config.Seed == 0 {
+			// No seed given so pick one, it is reported so that the same data set can be generated again
+			config.Seed = time.Now().UnixNano()
+		}
+		log.Printf("Using seed %d and size distribution %s for data generation\n", config.Seed, config.SizeDist)
+		fmt.Printf("Using seed %d and size distribution %s for data generation\n", config.Seed, config.SizeDist)
+	}
+
 	if t == ESourceType.ZERO() {
 		f := &zeroDataSource{}
-		err := f.Init(config.FileSize)
+		err := f.Init(dataSizeConfig{
+			dist: config.SizeDist,
+			seed: config.Seed,
+		})
 		if err != nil {
 			return nil, err
 		}
@@ -139,7 +275,10 @@ func createDataSource(t SourceType) (dataSource, error) {
 
 	} else if t == ESourceType.RANDOM() {
 		f := &randomDataSource{}
-		err := f.Init(config.FileSize)
+		err := f.Init(dataSizeConfig{
+			dist: config.SizeDist,
+			seed: config.Seed,
+		})
 		if err != nil {
 			return nil, err
 		}
@@ -149,7 +288,7 @@ func createDataSource(t SourceType) (dataSource, error) {
 		f := &fileDataSource{}
 		err := f.Init(fileDataSourceConfig{
 			filename: config.SourceFilePath,
-			filesize: config.FileSize,
+			filesize: config.SizeDist.Size(0),
 		})
 		if err != nil {
 			return nil, err
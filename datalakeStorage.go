@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+)
+
+const (
+	datalakeServiceVersion = "2021-06-08"
+	datalakeAppendSize     = 8 * 1024 * 1024
+)
+
+// DatalakeStorage : ADLS Gen2 account with hierarchical namespace
+// Files and directories are created through dfs endpoint while listing, properties and tier
+// operations are served by the blob endpoint of the same account
+type DatalakeStorage struct {
+	BlobStorage
+
+	dfsURL      *url.URL         // URL of the filesystem on dfs endpoint
+	dfsPipeline runtime.Pipeline // Pipeline used to send requests to dfs endpoint
+}
+
+func (ds *DatalakeStorage) Init() error {
+	err := ds.BlobStorage.Init()
+	if err != nil {
+		return err
+	}
+
+	ds.dfsURL, err = url.Parse(ds.getContainerURL("dfs"))
+	if err != nil {
+		return err
+	}
+
+	plOpts := runtime.PipelineOptions{}
+	switch ds.AuthType {
+	case EAuthType.KEY():
+		key, err := base64.StdEncoding.DecodeString(ds.StorageAccountKey)
+		if err != nil {
+			return fmt.Errorf("invalid storage account key (%s)", err.Error())
+		}
+		plOpts.PerRetry = append(plOpts.PerRetry, &sharedKeyPolicy{accountName: ds.StorageAccountName, accountKey: key})
+	case EAuthType.SAS():
+		ds.dfsURL.RawQuery = strings.TrimPrefix(ds.StorageAccountSAS, "?")
+	case EAuthType.SPN(), EAuthType.WORKLOAD_IDENTITY():
+		cred, err := ds.getTokenCredential()
+		if err != nil {
+			return err
+		}
+		plOpts.PerRetry = append(plOpts.PerRetry, runtime.NewBearerTokenPolicy(cred, []string{storageTokenScope}, nil))
+	default:
+		return fmt.Errorf("invalid authentication config, no usable credential found")
+	}
+
+	ds.dfsPipeline = runtime.NewPipeline("kalpavriksha", "v1.0.0", plOpts, nil)
+	return nil
+}
+
+func (ds *DatalakeStorage) TestConnection(ctx context.Context) error {
+	err := ds.BlobStorage.TestConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Files are written through dfs endpoint which may be blocked or not authorized even when blob works
+	_, err = ds.dfsSend(ctx, http.MethodGet, "",
+		url.Values{"resource": {"filesystem"}, "recursive": {"false"}, "maxResults": {"1"}},
+		nil, nil, http.StatusOK)
+	if err != nil {
+		return describeAuthError(ds.StorageConfig, "dfs list", err)
+	}
+
+	return nil
+}
+
+// dfsRequest : send a request for the given path under destination path to dfs endpoint
+func (ds *DatalakeStorage) dfsRequest(ctx context.Context, method string, name string, query url.Values, headers map[string]string, body []byte, status int) (http.Header, error) {
+	return ds.dfsSend(ctx, method, path.Join(ds.DestinationPath, name), query, headers, body, status)
+}
+
+// dfsSend : send a request for the given path of the filesystem to dfs endpoint, validate the
+// response status and return its headers
+func (ds *DatalakeStorage) dfsSend(ctx context.Context, method string, fsPath string, query url.Values, headers map[string]string, body []byte, status int) (http.Header, error) {
+	u := *ds.dfsURL
+	u.Path = path.Join(u.Path, fsPath)
+
+	if len(query) > 0 {
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += query.Encode()
+	}
+
+	req, err := runtime.NewRequest(ctx, method, u.String())
+	if err != nil {
+		return nil, err
+	}
+
+	req.Raw().Header.Set("x-ms-version", datalakeServiceVersion)
+	for k, v := range headers {
+		req.Raw().Header.Set(k, v)
+	}
+
+	if body != nil {
+		err = req.SetBody(streaming.NopCloser(bytes.NewReader(body)), "application/octet-stream")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := ds.dfsPipeline.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if !runtime.HasStatusCode(resp, status) {
+		return nil, runtime.NewResponseError(resp)
+	}
+
+	return resp.Header, nil
+}
+
+func (ds *DatalakeStorage) UploadData(ctx context.Context, name string, data []byte, o *UploadOptions) error {
+	return ds.upload(ctx, name, bytes.NewReader(data), int64(len(data)), datalakeAppendSize, o)
+}
+
+func (ds *DatalakeStorage) UploadStream(ctx context.Context, name string, r io.ReaderAt, size int64, o *UploadOptions) error {
+	return ds.upload(ctx, name, r, size, ds.BlockSize, o)
+}
+
+// upload : create the file, append data in chunks and then flush to commit it
+func (ds *DatalakeStorage) upload(ctx context.Context, name string, r io.ReaderAt, size int64, appendSize int64, o *UploadOptions) error {
+	_, err := ds.dfsRequest(ctx, http.MethodPut, name, url.Values{"resource": {"file"}}, nil, nil, http.StatusCreated)
+	if err != nil {
+		return err
+	}
+
+	err = forEachBlock(r, size, appendSize, func(offset int64, data []byte) error {
+		_, err := ds.dfsRequest(ctx, http.MethodPatch, name,
+			url.Values{"action": {"append"}, "position": {strconv.FormatInt(offset, 10)}},
+			nil, data, http.StatusAccepted)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{}
+	if o != nil && o.MD5Sum != nil {
+		headers["x-ms-content-md5"] = base64.StdEncoding.EncodeToString(o.MD5Sum)
+	}
+
+	_, err = ds.dfsRequest(ctx, http.MethodPatch, name,
+		url.Values{"action": {"flush"}, "position": {strconv.FormatInt(size, 10)}},
+		headers, nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	// dfs endpoint does not take tier while creating the file so set it through blob endpoint
+	if o != nil && o.Tier != nil {
+		return ds.BlobStorage.SetTier(ctx, name, *o.Tier)
+	}
+
+	return nil
+}
+
+func (ds *DatalakeStorage) Delete(ctx context.Context, name string, o *DeleteOptions) error {
+	// Directories are deleted with all their contents in a single call, stubs only if they are empty
+	recursive := o != nil && o.Recursive && !o.IsStub
+	query := url.Values{"recursive": {strconv.FormatBool(recursive)}}
+
+	for {
+		header, err := ds.dfsRequest(ctx, http.MethodDelete, name, query, nil, nil, http.StatusOK)
+		if err != nil {
+			return err
+		}
+
+		// Large directories are deleted over several calls, each picking up where the last one stopped
+		token := header.Get("x-ms-continuation")
+		if token == "" {
+			return nil
+		}
+		query.Set("continuation", token)
+	}
+}
+
+func (ds *DatalakeStorage) CreateStub(ctx context.Context, name string) error {
+	// Directories are real objects in hierarchical namespace so stub is just a directory
+	_, err := ds.dfsRequest(ctx, http.MethodPut, name,
+		url.Values{"resource": {"directory"}},
+		map[string]string{"If-None-Match": "*"}, nil, http.StatusCreated)
+
+	if bloberror.HasCode(err, bloberror.Code("PathAlreadyExists")) {
+		return newStorageError(http.MethodPut, name, http.StatusConflict, bloberror.BlobAlreadyExists)
+	}
+
+	return err
+}
+
+// -------------------------------------------------------------------
+// sharedKeyPolicy : sign dfs requests with storage account key
+type sharedKeyPolicy struct {
+	accountName string
+	accountKey  []byte
+}
+
+func (p *sharedKeyPolicy) Do(req *policy.Request) (*http.Response, error) {
+	raw := req.Raw()
+	raw.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+
+	contentLength := raw.Header.Get("Content-Length")
+	if contentLength == "0" {
+		contentLength = ""
+	}
+
+	stringToSign := strings.Join([]string{
+		raw.Method,
+		raw.Header.Get("Content-Encoding"),
+		raw.Header.Get("Content-Language"),
+		contentLength,
+		raw.Header.Get("Content-MD5"),
+		raw.Header.Get("Content-Type"),
+		"", // Date is passed in x-ms-date
+		raw.Header.Get("If-Modified-Since"),
+		raw.Header.Get("If-Match"),
+		raw.Header.Get("If-None-Match"),
+		raw.Header.Get("If-Unmodified-Since"),
+		raw.Header.Get("Range"),
+		p.canonicalizedHeaders(raw.Header),
+		p.canonicalizedResource(raw.URL),
+	}, "\n")
+
+	h := hmac.New(sha256.New, p.accountKey)
+	h.Write([]byte(stringToSign))
+	raw.Header.Set("Authorization", "SharedKey "+p.accountName+":"+base64.StdEncoding.EncodeToString(h.Sum(nil)))
+
+	return req.Next()
+}
+
+func (p *sharedKeyPolicy) canonicalizedHeaders(headers http.Header) string {
+	keys := make([]string, 0)
+	values := make(map[string]string)
+	for k, v := range headers {
+		name := strings.ToLower(strings.TrimSpace(k))
+		if strings.HasPrefix(name, "x-ms-") {
+			keys = append(keys, name)
+			values[name] = strings.Join(v, ",")
+		}
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		lines = append(lines, k+":"+values[k])
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (p *sharedKeyPolicy) canonicalizedResource(u *url.URL) string {
+	resource := "/" + p.accountName + u.EscapedPath()
+	if u.Path == "" {
+		resource += "/"
+	}
+
+	params := u.Query()
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		values := params[name]
+		sort.Strings(values)
+		resource += "\n" + strings.ToLower(name) + ":" + strings.Join(values, ",")
+	}
+	return resource
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestDatalakeStorage : datalake storage with blob served under /blob and dfs under /dfs of the server
+func newTestDatalakeStorage(t *testing.T, handler http.HandlerFunc) *DatalakeStorage {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	ds := &DatalakeStorage{BlobStorage: BlobStorage{StorageConfig: StorageConfig{
+		StorageEndPoint:         "blob",
+		StorageAccountContainer: "fs",
+		StorageAccountSAS:       "sv=2021&sig=abc",
+		AuthType:                EAuthType.SAS(),
+		ServiceEndpoints:        map[string]string{"blob": server.URL + "/blob", "dfs": server.URL + "/dfs"},
+		DestinationPath:         "dst",
+	}}}
+
+	if err := ds.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return ds
+}
+
+func TestDatalakeDeleteFollowsContinuation(t *testing.T) {
+	tokens := []string{}
+	ds := newTestDatalakeStorage(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete || r.URL.Path != "/dfs/fs/dst/dir" || r.URL.Query().Get("recursive") != "true" {
+			t.Errorf("unexpected %s %s", r.Method, r.URL)
+		}
+
+		token := r.URL.Query().Get("continuation")
+		tokens = append(tokens, token)
+		if len(tokens) < 3 {
+			w.Header().Set("x-ms-continuation", fmt.Sprintf("next-%d", len(tokens)))
+		}
+	})
+
+	err := ds.Delete(context.Background(), "dir", &DeleteOptions{Recursive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(tokens, ",") != ",next-1,next-2" {
+		t.Errorf("delete was called with continuation tokens %q", tokens)
+	}
+}
+
+func TestDatalakeTestConnectionChecksDfs(t *testing.T) {
+	dfsCalls := 0
+	ds := newTestDatalakeStorage(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/blob/") {
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?><EnumerationResults><Blobs></Blobs><NextMarker/></EnumerationResults>`))
+			return
+		}
+
+		dfsCalls++
+		if r.URL.Path != "/dfs/fs" || r.URL.Query().Get("resource") != "filesystem" {
+			t.Errorf("unexpected %s %s", r.Method, r.URL)
+		}
+		w.Header().Set("x-ms-error-code", "AuthorizationPermissionMismatch")
+		w.WriteHeader(http.StatusForbidden)
+	})
+
+	err := ds.TestConnection(context.Background())
+	if dfsCalls == 0 {
+		t.Fatalf("dfs endpoint was not checked")
+	}
+	if err == nil || !strings.Contains(err.Error(), "dfs list permission check failed") || !strings.Contains(err.Error(), "403") {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/JeffreyRichter/enum/enum"
+)
+
+// ------------------------------------------------------------------
+// Duration mode
+type DurationMode int
+
+var EDurationMode = DurationMode(0).INVALID_DURATION_MODE()
+
+func (DurationMode) INVALID_DURATION_MODE() DurationMode {
+	return DurationMode(0)
+}
+
+// Each pass over the data set after the first one creates new objects under its own directory
+func (DurationMode) NEW() DurationMode {
+	return DurationMode(1)
+}
+
+// Each pass works on the same objects again
+func (DurationMode) CYCLE() DurationMode {
+	return DurationMode(2)
+}
+
+func (f DurationMode) String() string {
+	return enum.StringInt(f, reflect.TypeOf(f))
+}
+
+func (a *DurationMode) Parse(s string) error {
+	enumVal, err := enum.ParseInt(reflect.TypeOf(a), s, true, false)
+	if enumVal != nil {
+		*a = enumVal.(DurationMode)
+	}
+
+	return err
+}
+
+// ------------------------------------------------------------------
+
+// validateDuration : check --duration and pick the mode when not given
+func validateDuration() error {
+	if config.Duration < 0 {
+		return fmt.Errorf("duration can not be negative")
+	}
+
+	if config.Duration == 0 {
+		return nil
+	}
+
+	if config.CreateStub || config.DeleteStub {
+		return fmt.Errorf("duration is not supported with create-stub and delete-stub")
+	}
+
+	if config.JournalPath != "" {
+		return fmt.Errorf("journal can not be used with --duration as items repeat across passes")
+	}
+
+	if config.DurationModeStr == "" {
+		config.DurationMode = EDurationMode.CYCLE()
+		if isUploadTask() {
+			config.DurationMode = EDurationMode.NEW()
+		}
+		return nil
+	}
+
+	err := config.DurationMode.Parse(config.DurationModeStr)
+	if err != nil || config.DurationMode == EDurationMode.INVALID_DURATION_MODE() {
+		return fmt.Errorf("invalid duration mode %s", config.DurationModeStr)
+	}
+
+	if config.DurationMode == EDurationMode.NEW() && !isUploadTask() {
+		return fmt.Errorf("duration mode new is only for upload, other tasks can only cycle over the data set")
+	}
+
+	return nil
+}
+
+// isMultiPass : items are generated again and again till --duration is over
+// Delete runs a single pass as objects are gone after it, duration just bounds how long it runs
+func isMultiPass() bool {
+	return config.Duration > 0 && !config.Delete
+}
+
+// getPassDir : directory holding objects of given pass in NEW mode, first pass uses the regular names
+func getPassDir(pass int64) string {
+	if pass == 0 {
+		return ""
+	}
+	return fmt.Sprintf("pass-%d/", pass)
+}
+
+// newWindow : context which is done once no new work should be started, when run is stopped or --duration is over
+func newWindow(stop context.Context) (context.Context, context.CancelFunc) {
+	if config.Duration > 0 {
+		return context.WithTimeout(stop, config.Duration)
+	}
+	return context.WithCancel(stop)
+}
+
+// isWindowOver : no new work should be started
+func isWindowOver() bool {
+	return kalpavriksha.window.Err() != nil
+}
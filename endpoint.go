@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	defaultEndpointSuffix = "core.windows.net"
+
+	// Well known account and endpoint of Azurite storage emulator
+	devStoreAccountName  = "devstoreaccount1"
+	devStoreAccountKey   = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+	devStoreBlobEndpoint = "http://127.0.0.1:10000/devstoreaccount1"
+)
+
+// isConnectionString : endpoint config can either be a URL or a storage connection string
+// URL may carry a SAS with '=' in it but never has ';' separated segments
+func isConnectionString(s string) bool {
+	return strings.Contains(s, "=") && (strings.Contains(s, ";") || !strings.Contains(s, "://"))
+}
+
+// parseConnectionString : split "key1=value1;key2=value2" in to a map with lower case keys
+func parseConnectionString(s string) (map[string]string, error) {
+	params := make(map[string]string)
+	for _, part := range strings.Split(s, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		// Values like SAS token and account key may have '=' in them so split only on the first one
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid connection string segment %s", part)
+		}
+
+		params[strings.ToLower(strings.TrimSpace(kv[0]))] = strings.TrimSpace(kv[1])
+	}
+
+	return params, nil
+}
+
+// applyConnectionString : fill account details and service endpoints from connection string
+// Values already provided through environment are not overridden
+func (c *StorageConfig) applyConnectionString(s string) error {
+	params, err := parseConnectionString(s)
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(params["usedevelopmentstorage"], "true") {
+		params["accountname"] = devStoreAccountName
+		params["accountkey"] = devStoreAccountKey
+		if params["blobendpoint"] == "" {
+			params["blobendpoint"] = devStoreBlobEndpoint
+		}
+	}
+
+	if c.StorageAccountName == "" {
+		c.StorageAccountName = params["accountname"]
+	}
+
+	if c.StorageAccountKey == "" && c.StorageAccountSAS == "" {
+		c.StorageAccountKey = params["accountkey"]
+		c.StorageAccountSAS = strings.TrimPrefix(params["sharedaccesssignature"], "?")
+	}
+
+	if params["endpointsuffix"] != "" {
+		c.EndpointSuffix = params["endpointsuffix"]
+	}
+
+	protocol := params["defaultendpointsprotocol"]
+	if protocol == "" {
+		protocol = "https"
+	}
+
+	if params["blobendpoint"] == "" && c.StorageAccountName != "" {
+		params["blobendpoint"] = fmt.Sprintf("%s://%s.blob.%s", protocol, c.StorageAccountName, c.getEndpointSuffix())
+	}
+
+	// Endpoints not given explicitly are derived from blob endpoint later
+	for _, service := range []string{"blob", "dfs", "file"} {
+		if endpoint := params[service+"endpoint"]; endpoint != "" {
+			c.ServiceEndpoints[service] = strings.TrimSuffix(endpoint, "/")
+		}
+	}
+
+	return nil
+}
+
+// resolveEndpoints : work out service endpoints from custom endpoint given by user
+func (c *StorageConfig) resolveEndpoints() error {
+	c.ServiceEndpoints = make(map[string]string)
+
+	if c.CustomEndpoint == "" {
+		return nil
+	}
+
+	if isConnectionString(c.CustomEndpoint) {
+		return c.applyConnectionString(c.CustomEndpoint)
+	}
+
+	u, err := url.Parse(c.CustomEndpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid endpoint %s", c.CustomEndpoint)
+	}
+
+	// SAS in the endpoint is used for auth, container URLs are built without it
+	if u.RawQuery != "" {
+		if c.StorageAccountKey == "" && c.StorageAccountSAS == "" {
+			c.StorageAccountSAS = u.RawQuery
+		}
+		u.RawQuery = ""
+	}
+	u.Fragment = ""
+
+	// Account name is the first label of host in virtual host style and first path segment in path style
+	virtualHost := strings.Contains(u.Host, ".blob.")
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if segments[0] == "" {
+		segments = nil
+	}
+
+	if c.StorageAccountName == "" {
+		if virtualHost {
+			c.StorageAccountName = strings.Split(u.Host, ".")[0]
+		} else if len(segments) > 0 {
+			c.StorageAccountName = segments[0]
+		}
+	}
+
+	// Endpoint may name the container as well, it is added back by getContainerURL
+	accountSegments := 1
+	if virtualHost {
+		accountSegments = 0
+	}
+	if n := len(segments); n > accountSegments && segments[n-1] == c.StorageAccountContainer {
+		segments = segments[:n-1]
+	}
+
+	u.Path = ""
+	if len(segments) > 0 {
+		u.Path = "/" + strings.Join(segments, "/")
+	}
+
+	// Endpoint URL is always of blob service, others are derived from it
+	c.ServiceEndpoints["blob"] = u.String()
+	return nil
+}
+
+func (c *StorageConfig) getEndpointSuffix() string {
+	if c.EndpointSuffix == "" {
+		return defaultEndpointSuffix
+	}
+	return c.EndpointSuffix
+}
+
+// getServiceURL : account level URL for given service (blob / dfs / file)
+//
+// Virtual host style : https://<account>.blob.core.windows.net
+// Path style         : http://127.0.0.1:10000/devstoreaccount1
+func (c *StorageConfig) getServiceURL(service string) string {
+	if endpoint, ok := c.ServiceEndpoints[service]; ok {
+		return endpoint
+	}
+
+	if endpoint, ok := c.ServiceEndpoints["blob"]; ok {
+		// Virtual host style endpoints have service name in the host, path style ones serve all services on same URL
+		u, err := url.Parse(endpoint)
+		if err == nil && strings.Contains(u.Host, ".blob.") {
+			u.Host = strings.Replace(u.Host, ".blob.", "."+service+".", 1)
+			return u.String()
+		}
+		return endpoint
+	}
+
+	return fmt.Sprintf("https://%s.%s.%s", c.StorageAccountName, service, c.getEndpointSuffix())
+}
+
+// getContainerURL : URL of the container (or share / filesystem) on given service
+func (c *StorageConfig) getContainerURL(service string) string {
+	serviceURL := c.getServiceURL(service)
+	u, err := url.Parse(serviceURL)
+	if err != nil {
+		return serviceURL + "/" + c.StorageAccountContainer
+	}
+
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + c.StorageAccountContainer
+	return u.String()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseConnectionString(t *testing.T) {
+	params, err := parseConnectionString(" AccountName=acct ; AccountKey=a2V5==;SharedAccessSignature=sv=2021&sig=abc%3D; ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys are lower cased and values keep '=' after the first one
+	if params["accountname"] != "acct" || params["accountkey"] != "a2V5==" || params["sharedaccesssignature"] != "sv=2021&sig=abc%3D" {
+		t.Errorf("parsed %v", params)
+	}
+
+	for _, s := range []string{"AccountName", "=value"} {
+		if _, err := parseConnectionString(s); err == nil {
+			t.Errorf("%q should be rejected", s)
+		}
+	}
+}
+
+// resolve : container URLs on blob and dfs for given endpoint with container "cont"
+func resolve(t *testing.T, endpoint string) (StorageConfig, string, string) {
+	c := StorageConfig{CustomEndpoint: endpoint, StorageAccountContainer: "cont"}
+	if err := c.resolveEndpoints(); err != nil {
+		t.Fatalf("%s: %v", endpoint, err)
+	}
+	return c, c.getContainerURL("blob"), c.getContainerURL("dfs")
+}
+
+func TestResolveEndpointsVirtualHost(t *testing.T) {
+	c, blobURL, dfsURL := resolve(t, "https://acct.blob.core.windows.net")
+	if c.StorageAccountName != "acct" || blobURL != "https://acct.blob.core.windows.net/cont" || dfsURL != "https://acct.dfs.core.windows.net/cont" {
+		t.Errorf("got account %s, %s and %s", c.StorageAccountName, blobURL, dfsURL)
+	}
+
+	// SAS moves to auth and is not part of container URL, nor is a container given in the endpoint
+	for _, endpoint := range []string{"https://acct.blob.core.windows.net/?sv=2021&sig=abc", "https://acct.blob.core.windows.net/cont?sv=2021&sig=abc"} {
+		c, blobURL, _ = resolve(t, endpoint)
+		if c.StorageAccountSAS != "sv=2021&sig=abc" || blobURL != "https://acct.blob.core.windows.net/cont" {
+			t.Errorf("%s: got sas %q and %s", endpoint, c.StorageAccountSAS, blobURL)
+		}
+	}
+}
+
+func TestResolveEndpointsPathStyle(t *testing.T) {
+	for _, endpoint := range []string{"http://127.0.0.1:10000/devstoreaccount1", "http://127.0.0.1:10000/devstoreaccount1/cont/"} {
+		c, blobURL, dfsURL := resolve(t, endpoint)
+		if c.StorageAccountName != "devstoreaccount1" {
+			t.Errorf("%s: account %s", endpoint, c.StorageAccountName)
+		}
+		if blobURL != "http://127.0.0.1:10000/devstoreaccount1/cont" || dfsURL != blobURL {
+			t.Errorf("%s: got %s and %s", endpoint, blobURL, dfsURL)
+		}
+	}
+}
+
+func TestResolveEndpointsConnectionString(t *testing.T) {
+	c, blobURL, _ := resolve(t, "UseDevelopmentStorage=true")
+	if c.StorageAccountName != devStoreAccountName || c.StorageAccountKey != devStoreAccountKey || blobURL != devStoreBlobEndpoint+"/cont" {
+		t.Errorf("development storage gave account %s and %s", c.StorageAccountName, blobURL)
+	}
+
+	c, blobURL, dfsURL := resolve(t, "DefaultEndpointsProtocol=https;AccountName=acct;AccountKey=a2V5;EndpointSuffix=core.chinacloudapi.cn")
+	if blobURL != "https://acct.blob.core.chinacloudapi.cn/cont" || dfsURL != "https://acct.dfs.core.chinacloudapi.cn/cont" {
+		t.Errorf("endpoint suffix gave %s and %s", blobURL, dfsURL)
+	}
+
+	c, _, _ = resolve(t, "BlobEndpoint=https://acct.blob.core.windows.net/;SharedAccessSignature=?sv=2021")
+	if c.StorageAccountSAS != "sv=2021" {
+		t.Errorf("sas %q", c.StorageAccountSAS)
+	}
+}
+
+func TestResolveEndpointsInvalid(t *testing.T) {
+	for _, endpoint := range []string{"acct.blob.core.windows.net", "https://", "AccountName"} {
+		c := StorageConfig{CustomEndpoint: endpoint}
+		if c.resolveEndpoints() == nil {
+			t.Errorf("%s should be rejected", endpoint)
+		}
+	}
+}
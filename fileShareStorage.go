@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azfile/directory"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azfile/file"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azfile/fileerror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azfile/share"
+)
+
+// Maximum size of a range that can be written to a file in one call
+const fileShareRangeSize = 4 * 1024 * 1024
+
+// FileShareStorage : Azure Files share, container name is used as the share name
+type FileShareStorage struct {
+	StorageConfig
+	ShareClient *share.Client // Client to hold share connection
+
+	createdDirs sync.Map // Directories already created by this run
+}
+
+func (fs *FileShareStorage) Init() error {
+	var err error
+	shareURL := fs.getContainerURL("file")
+
+	switch fs.AuthType {
+	case EAuthType.KEY():
+		cred, err := share.NewSharedKeyCredential(fs.StorageAccountName, fs.StorageAccountKey)
+		if err != nil {
+			return err
+		}
+
+		fs.ShareClient, err = share.NewClientWithSharedKeyCredential(shareURL, cred, nil)
+		if err != nil {
+			return err
+		}
+	case EAuthType.SAS():
+		fs.ShareClient, err = share.NewClientWithNoCredential(fmt.Sprintf("%s?%s", shareURL, fs.StorageAccountSAS), nil)
+		if err != nil {
+			return err
+		}
+	case EAuthType.SPN(), EAuthType.WORKLOAD_IDENTITY():
+		cred, err := fs.getTokenCredential()
+		if err != nil {
+			return err
+		}
+
+		// Token based access to file data requires backup intent, which lets the identity's RBAC role decide access
+		fs.ShareClient, err = share.NewClient(shareURL, cred, &share.ClientOptions{FileRequestIntent: to.Ptr(share.TokenIntentBackup)})
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid authentication config, no usable credential found")
+	}
+
+	return nil
+}
+
+func (fs *FileShareStorage) TestConnection(ctx context.Context) error {
+	// Try to list the share root and see if auth gets validated or not
+	pager := fs.ShareClient.NewRootDirectoryClient().NewListFilesAndDirectoriesPager(&directory.ListFilesAndDirectoriesOptions{
+		MaxResults: to.Ptr(int32(2)),
+	})
+
+	if pager.More() {
+		_, err := pager.NextPage(ctx)
+		if err != nil {
+			return describeAuthError(fs.StorageConfig, "list", err)
+		}
+	}
+
+	return nil
+}
+
+// getDirClient : client for given directory path, empty path is the share root
+func (fs *FileShareStorage) getDirClient(dirPath string) *directory.Client {
+	if dirPath == "" || dirPath == "." {
+		return fs.ShareClient.NewRootDirectoryClient()
+	}
+	return fs.ShareClient.NewDirectoryClient(dirPath)
+}
+
+// getFileClient : client for the given file name along with the directory holding it
+func (fs *FileShareStorage) getFileClient(name string) (*file.Client, string) {
+	filePath := path.Join(fs.DestinationPath, name)
+	dirPath := path.Dir(filePath)
+	return fs.getDirClient(dirPath).NewFileClient(path.Base(filePath)), dirPath
+}
+
+// createDirs : file share needs each directory in the path to exist before a file can be created
+func (fs *FileShareStorage) createDirs(ctx context.Context, dirPath string) error {
+	if dirPath == "" || dirPath == "." {
+		return nil
+	}
+
+	if _, ok := fs.createdDirs.Load(dirPath); ok {
+		return nil
+	}
+
+	err := fs.createDirs(ctx, path.Dir(dirPath))
+	if err != nil {
+		return err
+	}
+
+	_, err = fs.getDirClient(dirPath).Create(ctx, nil)
+	if err != nil && !fileerror.HasCode(err, fileerror.ResourceAlreadyExists) {
+		return err
+	}
+
+	fs.createdDirs.Store(dirPath, true)
+	return nil
+}
+
+func (fs *FileShareStorage) UploadData(ctx context.Context, name string, data []byte, o *UploadOptions) error {
+	return fs.UploadStream(ctx, name, bytes.NewReader(data), int64(len(data)), o)
+}
+
+func (fs *FileShareStorage) UploadStream(ctx context.Context, name string, r io.ReaderAt, size int64, o *UploadOptions) error {
+	fileClient, dirPath := fs.getFileClient(name)
+
+	err := fs.createDirs(ctx, dirPath)
+	if err != nil {
+		return err
+	}
+
+	// File is created with its final size and then data is written range by range
+	opts := &file.CreateOptions{}
+	if o != nil && o.MD5Sum != nil {
+		opts.HTTPHeaders = &file.HTTPHeaders{ContentMD5: o.MD5Sum}
+	}
+
+	_, err = fileClient.Create(ctx, size, opts)
+	if err != nil {
+		return err
+	}
+
+	// A range can not be larger than 4MB so block size is capped to it
+	rangeSize := int64(fileShareRangeSize)
+	if fs.BlockSize > 0 && fs.BlockSize < rangeSize {
+		rangeSize = fs.BlockSize
+	}
+
+	return forEachBlock(r, size, rangeSize, func(offset int64, data []byte) error {
+		_, err := fileClient.UploadRange(ctx, offset, streaming.NopCloser(bytes.NewReader(data)), nil)
+		return err
+	})
+}
+
+func (fs *FileShareStorage) DownloadData(ctx context.Context, name string, offset int64, count int64) ([]byte, error) {
+	fileClient, _ := fs.getFileClient(name)
+	resp, err := fileClient.DownloadStream(ctx, &file.DownloadStreamOptions{
+		Range: file.HTTPRange{Offset: offset, Count: count},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return io.ReadAll(resp.Body)
+}
+
+func (fs *FileShareStorage) Delete(ctx context.Context, name string, o *DeleteOptions) error {
+	if o != nil && (o.IsStub || o.Recursive) {
+		// Stubs are directories and file share can only delete a directory when it is empty
+		dirPath := path.Join(fs.DestinationPath, name)
+		_, err := fs.getDirClient(dirPath).Delete(ctx, nil)
+		if err == nil {
+			fs.createdDirs.Delete(dirPath)
+		}
+		return err
+	}
+
+	fileClient, _ := fs.getFileClient(name)
+	_, err := fileClient.Delete(ctx, nil)
+	return err
+}
+
+func (fs *FileShareStorage) SetTier(ctx context.Context, name string, tier blob.AccessTier) error {
+	return fmt.Errorf("tier can be set only at share level for file share")
+}
+
+func (fs *FileShareStorage) CreateStub(ctx context.Context, name string) error {
+	// Directories are real objects in file share so stub is just a directory
+	dirPath := path.Join(fs.DestinationPath, name)
+	err := fs.createDirs(ctx, path.Dir(dirPath))
+	if err != nil {
+		return err
+	}
+
+	_, err = fs.getDirClient(dirPath).Create(ctx, nil)
+	if fileerror.HasCode(err, fileerror.ResourceAlreadyExists) {
+		return newStorageError(http.MethodPut, dirPath, http.StatusConflict, bloberror.BlobAlreadyExists)
+	}
+
+	return err
+}
+
+func (fs *FileShareStorage) ListBlobs(name string) *runtime.Pager[container.ListBlobsHierarchyResponse] {
+	listPath := fs.DestinationPath
+	if listPath != "" {
+		listPath += "/"
+	}
+	listPath += name
+
+	// Prefix may end in a partial name so list the parent and filter on the remaining part
+	dirPart := ""
+	namePart := listPath
+	if idx := strings.LastIndex(listPath, "/"); idx >= 0 {
+		dirPart = listPath[:idx+1]
+		namePart = listPath[idx+1:]
+	}
+
+	opts := &directory.ListFilesAndDirectoriesOptions{}
+	if namePart != "" {
+		opts.Prefix = to.Ptr(namePart)
+	}
+	dirPager := fs.getDirClient(strings.TrimSuffix(dirPart, "/")).NewListFilesAndDirectoriesPager(opts)
+
+	return runtime.NewPager(runtime.PagingHandler[container.ListBlobsHierarchyResponse]{
+		More: func(page container.ListBlobsHierarchyResponse) bool {
+			return dirPager.More()
+		},
+		Fetcher: func(ctx context.Context, page *container.ListBlobsHierarchyResponse) (container.ListBlobsHierarchyResponse, error) {
+			result, err := dirPager.NextPage(ctx)
+			if err != nil {
+				return container.ListBlobsHierarchyResponse{}, err
+			}
+
+			resp := container.ListBlobsHierarchyResponse{}
+			resp.Prefix = to.Ptr(listPath)
+			resp.Delimiter = to.Ptr("/")
+			resp.Marker = result.Marker
+			resp.NextMarker = result.NextMarker
+			resp.Segment = &container.BlobHierarchyListSegment{}
+
+			for _, dir := range result.Segment.Directories {
+				resp.Segment.BlobPrefixes = append(resp.Segment.BlobPrefixes, &container.BlobPrefix{Name: to.Ptr(dirPart + *dir.Name + "/")})
+			}
+
+			for _, f := range result.Segment.Files {
+				item := &container.BlobItem{
+					Name:       to.Ptr(dirPart + *f.Name),
+					Properties: &container.BlobProperties{},
+				}
+				if f.Properties != nil {
+					item.Properties.ContentLength = f.Properties.ContentLength
+					item.Properties.LastModified = f.Properties.LastModified
+					item.Properties.ETag = f.Properties.ETag
+				}
+				resp.Segment.BlobItems = append(resp.Segment.BlobItems, item)
+			}
+
+			return resp, nil
+		},
+	})
+}
+
+func (fs *FileShareStorage) GetProperties(ctx context.Context, name string) (blob.GetPropertiesResponse, error) {
+	fileClient, _ := fs.getFileClient(name)
+	prop, err := fileClient.GetProperties(ctx, nil)
+	if err != nil {
+		return blob.GetPropertiesResponse{}, err
+	}
+
+	return blob.GetPropertiesResponse{
+		ContentLength: prop.ContentLength,
+		ContentMD5:    prop.ContentMD5,
+		LastModified:  prop.LastModified,
+		ETag:          prop.ETag,
+		Metadata:      prop.Metadata,
+	}, nil
+}
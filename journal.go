@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+// Interval at which journal is flushed and synced to disk, work done after last sync is redone on resume
+const journalSyncInterval = 5 * time.Second
+
+// Prefix of the first line of a journal, followed by task it was written for
+const journalHeader = "# kalpavriksha journal task="
+
+// journal : append only record of completed work items so an interrupted run can be resumed
+// Each line is "<status>\t<path>", a later line for the same path overrides the earlier one
+type journal struct {
+	file     *os.File
+	lastSync time.Time
+
+	// Lines recorded since last sync, kept in memory instead of a bufio.Writer which would write them
+	// out on its own once full, possibly ahead of the manifest entries of those items
+	pending bytes.Buffer
+
+	// Items which succeeded in previous runs, kept as 64 bit hash of the path so that tens of
+	// millions of items fit in memory
+	done map[uint64]struct{}
+}
+
+// getTaskName : task performed by this run, journal of one task can not be used to resume another
+func getTaskName() string {
+	if config.Delete {
+		return "delete"
+	} else if config.SetTier {
+		return "set-tier"
+	}
+	return "upload"
+}
+
+// isUploadTask : run generates the data set, which is what it does when no other task is asked for
+func isUploadTask() bool {
+	return !(config.Delete || config.SetTier || config.Verify || config.Read || config.Stat || config.MixStr != "" || config.CreateStub || config.DeleteStub)
+}
+
+func getJournalKey(name string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return h.Sum64()
+}
+
+// openJournal : open the journal, on resume load items completed earlier and keep appending to it
+func openJournal(path string, resume bool) (*journal, error) {
+	j := &journal{done: make(map[uint64]struct{}), lastSync: time.Now()}
+
+	if resume {
+		err := j.load(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	f, err := openForResume(path, resume)
+	if err != nil {
+		return nil, err
+	}
+
+	j.file = f
+
+	info, err := f.Stat()
+	if err == nil && info.Size() == 0 {
+		fmt.Fprintf(&j.pending, "%s%s\n", journalHeader, getTaskName())
+	}
+
+	return j, nil
+}
+
+// openForResume : create the file, or open it for appending when a run is resumed
+// A line cut short when the process died is dropped so that lines added on resume start afresh
+func openForResume(path string, resume bool) (*os.File, error) {
+	if !resume {
+		return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// Walk back from the end to the last complete line
+	buf := make([]byte, 4096)
+	end := info.Size()
+	for end > 0 {
+		n := int64(len(buf))
+		if n > end {
+			n = end
+		}
+
+		_, err = f.ReadAt(buf[:n], end-n)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			end = end - n + int64(i) + 1
+			break
+		}
+		end -= n
+	}
+
+	if end < info.Size() {
+		err = f.Truncate(end)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// load : read items completed by earlier runs from the journal
+func (j *journal) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, journalHeader) {
+			task := strings.TrimPrefix(line, journalHeader)
+			if task != getTaskName() {
+				return fmt.Errorf("journal %s was written for %s and can not be used to resume %s", path, task, getTaskName())
+			}
+			continue
+		}
+
+		status, name, ok := strings.Cut(line, "\t")
+		if !ok {
+			// Last line may be cut short if process died while writing it
+			continue
+		}
+
+		if status == EJobStatusType.SUCCESS().String() {
+			j.done[getJournalKey(name)] = struct{}{}
+		} else {
+			delete(j.done, getJournalKey(name))
+		}
+	}
+
+	return scanner.Err()
+}
+
+// isDone : item was completed successfully by an earlier run
+func (j *journal) isDone(name string) bool {
+	_, ok := j.done[getJournalKey(name)]
+	return ok
+}
+
+// record : add outcome of a work item, called only from the goroutine collecting results
+func (j *journal) record(job *workItem) error {
+	fmt.Fprintf(&j.pending, "%s\t%s\n", job.status, job.path)
+
+	if time.Since(j.lastSync) >= journalSyncInterval {
+		j.lastSync = time.Now()
+		return j.sync()
+	}
+	return nil
+}
+
+// sync : make the journal durable, manifest goes first so that an item is never done as per
+// the journal while its manifest entry was lost, resume would skip it and it would never be recorded
+// This is the only place journal is written to the file, which keeps that order
+func (j *journal) sync() error {
+	if kalpavriksha.manifest != nil {
+		err := kalpavriksha.manifest.Sync()
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := j.pending.WriteTo(j.file)
+	if err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+func (j *journal) Close() error {
+	err := j.sync()
+	if err != nil {
+		j.file.Close()
+		return err
+	}
+	return j.file.Close()
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Items written by the process which gets killed, and how many of them are synced before that
+const (
+	crashItems  = 1000
+	crashSynced = 50
+)
+
+func getCrashItemName(i int) string {
+	return fmt.Sprintf("dir-%d/%s/file-%d", i%10, strings.Repeat("x", 64), i)
+}
+
+// writeCrashItem : manifest entry goes before the journal line, the way upload workers and
+// the results collector order them
+func writeCrashItem(t *testing.T, j *journal, i int) {
+	name := getCrashItemName(i)
+	err := kalpavriksha.manifest.Write(&manifestEntry{Path: name, Type: "FILE", Status: EJobStatusType.SUCCESS().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = j.record(&workItem{path: name, status: EJobStatusType.SUCCESS()})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func openCrashFiles(t *testing.T, dir string, resume bool) *journal {
+	mw, err := newManifestWriter(filepath.Join(dir, "manifest.jsonl"), resume)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kalpavriksha.manifest = mw
+
+	j, err := openJournal(filepath.Join(dir, "journal"), resume)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return j
+}
+
+// TestJournalCrashHelper : runs only as the child of TestJournalResumeAfterKill, records items
+// and kills itself as soon as journal reaches the disk beyond its last sync, or after all items
+func TestJournalCrashHelper(t *testing.T) {
+	dir := os.Getenv("KALPAVRIKSHA_CRASH_DIR")
+	if dir == "" {
+		t.Skip("only run by TestJournalResumeAfterKill")
+	}
+
+	j := openCrashFiles(t, dir, false)
+	for i := 0; i < crashSynced; i++ {
+		writeCrashItem(t, j, i)
+	}
+	if err := j.sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := j.file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	synced := info.Size()
+
+	for i := crashSynced; i < crashItems; i++ {
+		writeCrashItem(t, j, i)
+
+		info, err = j.file.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != synced {
+			break
+		}
+	}
+
+	p, _ := os.FindProcess(os.Getpid())
+	p.Kill()
+	select {}
+}
+
+func TestJournalResumeAfterKill(t *testing.T) {
+	dir := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestJournalCrashHelper$")
+	cmd.Env = append(os.Environ(), "KALPAVRIKSHA_CRASH_DIR="+dir)
+	out, err := cmd.CombinedOutput()
+	if err == nil || !strings.Contains(err.Error(), "killed") {
+		t.Fatalf("helper process was not killed, %v : %s", err, out)
+	}
+
+	defer func() { kalpavriksha.manifest = nil }()
+	j := openCrashFiles(t, dir, true)
+
+	inManifest := map[string]bool{}
+	err = readManifest(filepath.Join(dir, "manifest.jsonl"), func(e *manifestEntry) {
+		inManifest[e.Path] = true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Resume skips what journal has as done, so each of those needs its manifest entry
+	for i := 0; i < crashItems; i++ {
+		name := getCrashItemName(i)
+		if i < crashSynced && !j.isDone(name) {
+			t.Errorf("%s was synced before the kill but is not done as per journal", name)
+		}
+		if j.isDone(name) && !inManifest[name] {
+			t.Errorf("%s is done as per journal but missing in manifest", name)
+		}
+	}
+
+	// Resumed run completes the rest, after which every item is in both
+	for i := 0; i < crashItems; i++ {
+		if !j.isDone(getCrashItemName(i)) {
+			writeCrashItem(t, j, i)
+		}
+	}
+	if err = kalpavriksha.manifest.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	j = openCrashFiles(t, dir, true)
+	defer j.Close()
+	defer kalpavriksha.manifest.Close()
+
+	count := 0
+	err = readManifest(filepath.Join(dir, "manifest.jsonl"), func(e *manifestEntry) {
+		if j.isDone(e.Path) {
+			count++
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count < crashItems || len(j.done) != crashItems {
+		t.Errorf("after resume %d manifest entries are done as per journal, with %d items done, expected %d", count, len(j.done), crashItems)
+	}
+}
@@ -7,9 +7,12 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"time"
 )
 
 func main() {
+	runStart := time.Now()
+
 	file, err := os.OpenFile("kalpavriksha.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
 	if err != nil {
 		log.Fatal(err)
@@ -34,20 +37,136 @@ func main() {
 		return
 	}
 
-	kalpavriksha.storage, err = createStorage(EStorageType.BLOB(), config.StorageConfig)
+	// Interrupt or run timeout stops the run, see newRunContext
+	ctx, stop, cleanup := newRunContext()
+	defer cleanup()
+	kalpavriksha.stop = stop
+
+	kalpavriksha.storage, err = createStorage(ctx, config.AccountType, config.StorageConfig)
 	if err != nil {
 		fmt.Println("failed to connect to storage.", err.Error())
 		return
 	}
 
+	// Every storage call of the workload from here on is timed, untimed client is kept aside for
+	// bookkeeping calls and for the memory storage dump at the end
+	kalpavriksha.backend = kalpavriksha.storage
+	kalpavriksha.stats = newStatsCollector()
+	kalpavriksha.storage = &statsStorage{Storage: kalpavriksha.backend, stats: kalpavriksha.stats}
+
 	kalpavriksha.dataSrc, err = createDataSource(config.InputType)
 	if err != nil {
 		fmt.Println("failed to create data source.", err.Error())
 		return
 	}
 
-	startWorkers()
-	fmt.Println("Kalpavrikhsa completed")
+	if config.MixStr != "" {
+		kalpavriksha.mix, err = newMixedWorkload()
+		if err != nil {
+			fmt.Println("failed to prepare mix.", err.Error())
+			return
+		}
+
+		log.Printf("Running mix %s over %d files\n", config.MixStr, len(kalpavriksha.mix.names))
+		fmt.Printf("Running mix %s over %d files\n", config.MixStr, len(kalpavriksha.mix.names))
+	}
+
+	if config.Stat {
+		kalpavriksha.stat, err = newStatWorkload()
+		if err != nil {
+			fmt.Println("failed to prepare stat.", err.Error())
+			return
+		}
+
+		log.Printf("Running %s stat over %d files\n", config.StatPattern, len(kalpavriksha.stat.names))
+		fmt.Printf("Running %s stat over %d files\n", config.StatPattern, len(kalpavriksha.stat.names))
+	}
+
+	if config.NameTemplate.timed {
+		// Reported so that the same names can be generated again for delete or verify
+		log.Printf("Using name time %d for name template %s\n", config.NameTime.Unix(), config.NameTemplate)
+		fmt.Printf("Using name time %d for name template %s\n", config.NameTime.Unix(), config.NameTemplate)
+	}
+
+	if config.JournalPath != "" {
+		kalpavriksha.journal, err = openJournal(config.JournalPath, config.Resume)
+		if err != nil {
+			fmt.Println("failed to open journal.", err.Error())
+			return
+		}
+
+		if config.Resume {
+			log.Printf("Resuming, %d items already completed as per journal %s\n", len(kalpavriksha.journal.done), config.JournalPath)
+			fmt.Printf("Resuming, %d items already completed as per journal %s\n", len(kalpavriksha.journal.done), config.JournalPath)
+		}
+	}
+
+	if config.ManifestOutPath != "" {
+		kalpavriksha.manifest, err = newManifestWriter(config.ManifestOutPath, config.Resume)
+		if err != nil {
+			fmt.Println("failed to create manifest.", err.Error())
+			return
+		}
+	}
+
+	// Window for --duration starts along with the workers
+	window, closeWindow := newWindow(stop)
+	defer closeWindow()
+	kalpavriksha.window = window
+
+	stopReporter := startStatsReporter(kalpavriksha.stats, config.StatsInterval)
+	startWorkers(ctx)
+	stopReporter()
+	printStats(kalpavriksha.stats)
+
+	if kalpavriksha.manifest != nil {
+		if err = kalpavriksha.manifest.Close(); err != nil {
+			fmt.Println("failed to write manifest.", err.Error())
+		}
+	}
+
+	if kalpavriksha.journal != nil {
+		if err = kalpavriksha.journal.Close(); err != nil {
+			fmt.Println("failed to write journal.", err.Error())
+		}
+	}
+
+	if ms, ok := kalpavriksha.backend.(*MemoryStorage); ok && config.MemoryDumpPath != "" {
+		if err = ms.DumpToFile(config.MemoryDumpPath); err != nil {
+			fmt.Println("failed to dump memory storage.", err.Error())
+		}
+	}
+
+	summary := fmt.Sprintf("Items : %d succeeded, %d failed", kalpavriksha.itemCounts[EJobStatusType.SUCCESS()], kalpavriksha.itemCounts[EJobStatusType.FAILED()])
+	if skipped := kalpavriksha.itemCounts[EJobStatusType.SKIPPED()]; skipped > 0 {
+		summary += fmt.Sprintf(", %d skipped", skipped)
+	}
+	if kalpavriksha.itemsTotal > 0 {
+		summary += fmt.Sprintf(" of %d", kalpavriksha.itemsTotal)
+	}
+	log.Println(summary)
+	fmt.Println(summary)
+
+	reason := getStopReason(ctx, stop)
+	failed := config.Verify && verificationFailed()
+
+	if config.ReportPath != "" {
+		if err = writeReport(newRunReport(runStart, reason, failed), config.ReportPath); err != nil {
+			fmt.Println("failed to write report.", err.Error())
+		}
+	}
+
+	if reason != "" {
+		log.Printf("Kalpavrikhsa stopped (%s)\n", reason)
+		fmt.Printf("Kalpavrikhsa stopped (%s)\n", reason)
+	} else {
+		fmt.Println("Kalpavrikhsa completed")
+	}
+
+	if reason != "" || failed {
+		cleanup()
+		os.Exit(1)
+	}
 }
 
 func init() {
@@ -56,15 +175,32 @@ func init() {
 	flag.Int64Var(&config.NumberOfDirs, "dirs", 1, "Number of directories to be created")
 	flag.Int64Var(&config.DirDepth, "depth", 0, "Number of sub-directory inside which file will be created")
 	flag.Int64Var(&config.NumberOfFiles, "files", 1, "Number of files to be created per directory")
+	flag.StringVar(&config.FanoutStr, "fanout", "", "Number of sub-directories per level e.g. 10,20,5, overrides --dirs and --depth")
+	flag.StringVar(&config.FilesPerLevelStr, "files-per-level", "", "Number of files per directory at each level e.g. 0,5,100, by default only leaf directories get --files")
+	flag.Float64Var(&config.FanoutJitter, "fanout-jitter", 0, "Randomise fan-out of each directory by up to this fraction (0 - 1)")
+	flag.Float64Var(&config.EmptyDirRatio, "empty-dir-ratio", 0, "Fraction of directories in the tree to be left empty (0 - 1)")
 	flag.Int64Var(&config.FileSize, "size", 1, "Size of each file to be created")
+	flag.StringVar(&config.SizeDistStr, "size-dist", "", "Distribution of file sizes fixed / uniform / lognormal / pareto / buckets / histogram, overrides --size")
 	flag.IntVar(&config.Parallelism, "concurrency", 64, "Number of threads to run in parllel")
 
+	flag.Int64Var(&config.BlockSize, "block-size", 0, "Size of each block in MB, when given files are generated and uploaded block by block")
 	flag.StringVar(&config.InputTypeStr, "type", "random", "Type of source ZERO / RANDOM / FILE")
 
+	flag.Int64Var(&config.Seed, "seed", 0, "Seed for random data, same seed generates same content for each file (0 picks a seed from clock and prints it)")
 	flag.StringVar(&config.SourceFilePath, "src-file", "", "Source file to be used for data")
+	flag.StringVar(&config.NameTemplateStr, "name-template", defaultNameTemplate, "Template for name of each file e.g. {dir}/{level}/{uuid}.{ext:csv,json,parquet}")
+	flag.StringVar(&config.NameTimeStr, "name-time", "", "Time used by {time} in name template, RFC3339 or unix seconds (defaults to current time)")
+	flag.StringVar(&config.PrefixStrategyStr, "prefix-strategy", "none", "Prefix for each generated path NONE / HASH / REVERSE / SHARD / HOT to spread or concentrate name ranges")
+	flag.IntVar(&config.PrefixLen, "prefix-len", 0, "Length of prefix for HASH (default 4) and REVERSE (default 8) strategies")
+	flag.Int64Var(&config.PrefixShards, "prefix-shards", 16, "Number of shards for SHARD prefix strategy")
 	flag.StringVar(&config.DestinationPath, "dst-path", "", "Destination path after the container where files will be created")
 
-	flag.StringVar(&config.StorageEndPoint, "acct-type", "blob", "Stroage account type")
+	flag.StringVar(&config.StorageEndPoint, "acct-type", "blob", "Stroage account type blob / dfs / file / local / memory / s3")
+	flag.StringVar(&config.CustomEndpoint, "endpoint", "", "Storage endpoint URL or connection string e.g. Azurite, private endpoint or custom domain")
+	flag.StringVar(&config.EndpointSuffix, "endpoint-suffix", "", "Endpoint suffix for sovereign clouds e.g. core.chinacloudapi.cn")
+	flag.StringVar(&config.AuthTypeStr, "auth-type", "", "Auth method key / sas / spn / workload_identity, picked from environment when not given")
+	flag.StringVar(&config.LocalRootPath, "local-path", "", "Root directory where data will be generated for local account type")
+	flag.StringVar(&config.MemoryDumpPath, "mem-dump", "", "File to dump generated data set at the end for memory account type")
 
 	flag.BoolVar(&config.UpdateMD5, "md5", false, "Set MD5 Sum on upload")
 	flag.StringVar(&config.Tier, "tier", "none", "Tier to be set for each file")
@@ -72,6 +208,43 @@ func init() {
 	flag.BoolVar(&config.Delete, "delete", false, "Delete the data set instead of generation")
 	flag.BoolVar(&config.SetTier, "set-tier", false, "Change the tier of previously generated dataset")
 
+	flag.BoolVar(&config.Verify, "verify", false, "Read back previously generated data set and validate size, MD5 and content")
+	flag.IntVar(&config.VerifyRanges, "verify-ranges", 0, "Number of 1MB ranges to validate per file during verify, 0 validates complete file")
+
+	flag.StringVar(&config.ManifestOutPath, "manifest-out", "", "File to record each object created by upload, CSV if it ends in .csv else JSONL")
+	flag.StringVar(&config.ManifestPath, "manifest", "", "Manifest of a previous run to use as job source for delete, set-tier and verify")
+
+	flag.DurationVar(&config.OpTimeout, "op-timeout", 0, "Time allowed for each storage call e.g. 30s, a complete file upload is one call (0 means no limit)")
+	flag.DurationVar(&config.RunTimeout, "run-timeout", 0, "Time allowed for the complete run e.g. 2h, work in flight is aborted when it expires (0 means no limit)")
+
+	flag.StringVar(&config.JournalPath, "journal", "", "File to record each completed item so that an interrupted run can be resumed")
+	flag.BoolVar(&config.Resume, "resume", false, "Resume an interrupted run, skip items completed as per --journal and retry failed ones")
+
+	flag.BoolVar(&config.Read, "read", false, "Read back previously generated data set to measure read throughput and latency")
+	flag.StringVar(&config.ReadPatternStr, "read-pattern", "full", "How each file is read by --read and --mix FULL / SEQUENTIAL ranges / RANDOM ranges")
+	flag.StringVar(&config.ReadSizeStr, "read-size", "1MiB", "Size of each range for SEQUENTIAL and RANDOM read patterns e.g. 4KiB")
+	flag.IntVar(&config.ReadCount, "read-count", 1, "Number of ranges read at random offsets from each file for RANDOM read pattern")
+
+	flag.BoolVar(&config.Stat, "stat", false, "Get properties of files of previously generated data set to measure metadata calls")
+	flag.StringVar(&config.StatPatternStr, "stat-pattern", "sequential", "Order in which --stat picks files SEQUENTIAL / RANDOM / ZIPF")
+	flag.Float64Var(&config.StatZipf, "stat-zipf", 1.0, "Skew of ZIPF stat pattern, larger value concentrates calls on fewer files")
+	flag.Float64Var(&config.StatList, "stat-list", 0, "Percentage of --stat calls which list the directory of the file instead of getting its properties")
+	flag.Int64Var(&config.StatOps, "stat-ops", 0, "Number of calls of --stat in one pass (0 means one per file of the data set)")
+
+	flag.StringVar(&config.MixStr, "mix", "", "Run a weighted mix of operations over an existing data set e.g. read=60,write=25,stat=10,delete=5,list=0")
+	flag.Int64Var(&config.MixOps, "mix-ops", 0, "Number of operations of --mix in one pass (0 means one per file of the data set)")
+
+	flag.DurationVar(&config.Duration, "duration", 0, "Keep starting new work for this long e.g. 6h, passing over the data set again and again (0 means a single pass)")
+	flag.StringVar(&config.DurationModeStr, "duration-mode", "", "With --duration, NEW writes each later pass under pass-N/ and CYCLE repeats the same objects (default NEW for upload, CYCLE otherwise)")
+
+	flag.Float64Var(&config.OpsRate, "ops-rate", 0, "Items started per second across all workers, latency is measured from when each item was due (0 means no limit)")
+	flag.Float64Var(&config.Bandwidth, "bandwidth", 0, "MB per second uploaded or verified across all workers (0 means no limit)")
+	flag.Float64Var(&config.WorkerOpsRate, "worker-ops-rate", 0, "Items started per second by each worker (0 means no limit)")
+	flag.Float64Var(&config.WorkerBandwidth, "worker-bandwidth", 0, "MB per second uploaded or verified by each worker (0 means no limit)")
+
+	flag.StringVar(&config.ReportPath, "report", "", "File to write JSON report of the run with config, counts, bytes, errors and latency stats, - writes it to stdout")
+	flag.DurationVar(&config.StatsInterval, "stats-interval", 30*time.Second, "Interval at which latency and throughput of each operation is printed during the run (0 prints only the final summary)")
+
 	flag.BoolVar(&config.CreateStub, "create-stub", false, "Create directory stub on the given path")
 	flag.BoolVar(&config.DeleteStub, "delete-stub", false, "Delete directory stub on the given path")
 }
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+)
+
+// LocalStorage : generate data on a local path, NFS export or a blobfuse mount point
+type LocalStorage struct {
+	StorageConfig
+}
+
+func (ls *LocalStorage) Init() error {
+	if ls.LocalRootPath == "" {
+		return fmt.Errorf("root path not provided for local storage")
+	}
+
+	ls.LocalRootPath = filepath.Clean(ls.LocalRootPath)
+	return nil
+}
+
+func (ls *LocalStorage) TestConnection(ctx context.Context) error {
+	// Make sure destination exists and we are allowed to write there
+	dstPath := filepath.Join(ls.LocalRootPath, filepath.FromSlash(ls.DestinationPath))
+	err := os.MkdirAll(dstPath, 0777)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(dstPath, ".kalpavriksha-")
+	if err != nil {
+		return err
+	}
+
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// getPath : convert blob style name to path on local filesystem
+func (ls *LocalStorage) getPath(name string) string {
+	return filepath.Join(ls.LocalRootPath, filepath.FromSlash(ls.DestinationPath), filepath.FromSlash(name))
+}
+
+// createWithParents : create parent directories of the path and then call create, a delete running
+// in parallel may prune the parents in between (see removeEmptyParents) so that is tried once more
+func createWithParents(path string, create func() error) error {
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		err = os.MkdirAll(filepath.Dir(path), 0777)
+		if err == nil {
+			err = create()
+		}
+
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return err
+}
+
+func (ls *LocalStorage) UploadData(ctx context.Context, name string, data []byte, o *UploadOptions) error {
+	path := ls.getPath(name)
+
+	// Filesystem has no place to hold MD5 Sum or tier so upload options are ignored
+	return createWithParents(path, func() error {
+		return os.WriteFile(path, data, 0666)
+	})
+}
+
+func (ls *LocalStorage) UploadStream(ctx context.Context, name string, r io.ReaderAt, size int64, o *UploadOptions) error {
+	path := ls.getPath(name)
+
+	var f *os.File
+	err := createWithParents(path, func() error {
+		var err error
+		f, err = os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = forEachBlock(r, size, ls.BlockSize, func(offset int64, data []byte) error {
+		_, err := f.Write(data)
+		return err
+	})
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func (ls *LocalStorage) DownloadData(ctx context.Context, name string, offset int64, count int64) ([]byte, error) {
+	path := ls.getPath(name)
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, newStorageError(http.MethodGet, name, http.StatusNotFound, bloberror.BlobNotFound)
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	_, err = f.Seek(offset, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	if count <= 0 {
+		return io.ReadAll(f)
+	}
+	return io.ReadAll(io.LimitReader(f, count))
+}
+
+func (ls *LocalStorage) Delete(ctx context.Context, name string, o *DeleteOptions) error {
+	path := ls.getPath(name)
+	err := os.Remove(path)
+
+	if err != nil && o != nil && o.IsStub {
+		// Directories are deleted along with their files by other workers, one still holding files
+		// or already gone is removed by the last delete inside it
+		entries, readErr := os.ReadDir(path)
+		if errors.Is(readErr, fs.ErrNotExist) || (readErr == nil && len(entries) > 0) {
+			err = nil
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	ls.removeEmptyParents(path)
+	return nil
+}
+
+// removeEmptyParents : remove directories left empty by a delete, like blob storage where a directory
+// exists only as long as something is in it, stops at the first one which still has entries
+func (ls *LocalStorage) removeEmptyParents(path string) {
+	root := ls.getPath("")
+	for dir := filepath.Dir(path); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+func (ls *LocalStorage) SetTier(ctx context.Context, name string, tier blob.AccessTier) error {
+	return fmt.Errorf("set tier is not supported on local storage")
+}
+
+func (ls *LocalStorage) CreateStub(ctx context.Context, name string) error {
+	path := ls.getPath(name)
+	return createWithParents(path, func() error {
+		return os.MkdirAll(path, 0777)
+	})
+}
+
+func (ls *LocalStorage) ListBlobs(name string) *runtime.Pager[container.ListBlobsHierarchyResponse] {
+	listPath := ls.DestinationPath
+	if listPath != "" {
+		listPath += "/"
+	}
+	listPath += name
+
+	// Prefix may end in a partial name so read the parent and filter on the remaining part
+	dirPart := ""
+	namePart := listPath
+	if idx := strings.LastIndex(listPath, "/"); idx >= 0 {
+		dirPart = listPath[:idx+1]
+		namePart = listPath[idx+1:]
+	}
+
+	items := make([]*container.BlobItem, 0)
+	prefixes := make([]*container.BlobPrefix, 0)
+
+	entries, err := os.ReadDir(filepath.Join(ls.LocalRootPath, filepath.FromSlash(dirPart)))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Failed to list %s (%s)\n", listPath, err.Error())
+	}
+
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), namePart) {
+			continue
+		}
+
+		if entry.IsDir() {
+			prefixes = append(prefixes, &container.BlobPrefix{Name: to.Ptr(dirPart + entry.Name() + "/")})
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		items = append(items, &container.BlobItem{
+			Name: to.Ptr(dirPart + entry.Name()),
+			Properties: &container.BlobProperties{
+				ContentLength: to.Ptr(info.Size()),
+				LastModified:  to.Ptr(info.ModTime()),
+				ETag:          to.Ptr(localETag(info)),
+			},
+		})
+	}
+
+	return newStaticListPager(listPath, items, prefixes)
+}
+
+func (ls *LocalStorage) GetProperties(ctx context.Context, name string) (blob.GetPropertiesResponse, error) {
+	info, err := os.Stat(ls.getPath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return blob.GetPropertiesResponse{}, newStorageError(http.MethodHead, name, http.StatusNotFound, bloberror.BlobNotFound)
+	} else if err != nil {
+		return blob.GetPropertiesResponse{}, err
+	}
+
+	resp := blob.GetPropertiesResponse{
+		ContentLength: to.Ptr(info.Size()),
+		LastModified:  to.Ptr(info.ModTime()),
+		ETag:          to.Ptr(localETag(info)),
+	}
+
+	if info.IsDir() {
+		resp.Metadata = map[string]*string{"hdi_isfolder": to.Ptr("true")}
+		resp.ContentLength = to.Ptr(int64(0))
+	}
+
+	return resp, nil
+}
+
+// localETag : there is no etag on a filesystem so derive one from size and modified time
+func localETag(info fs.FileInfo) azcore.ETag {
+	return azcore.ETag(fmt.Sprintf("\"%x-%x\"", info.ModTime().UnixNano()/int64(time.Microsecond), info.Size()))
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalStorageDeletePrunesEmptyDirs(t *testing.T) {
+	ctx := context.Background()
+	ls := &LocalStorage{StorageConfig{LocalRootPath: t.TempDir(), DestinationPath: "dst"}}
+	if err := ls.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a/b/x", "a/y"} {
+		if err := ls.UploadData(ctx, name, []byte(name), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := ls.Delete(ctx, "a/b/x", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(ls.getPath("a/b")); !os.IsNotExist(err) {
+		t.Errorf("a/b left behind after deleting its only file")
+	}
+	if _, err := os.Stat(ls.getPath("a")); err != nil {
+		t.Errorf("a removed while it still holds a file")
+	}
+
+	// Destination path itself is never removed
+	if err := ls.Delete(ctx, "a/y", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(ls.getPath("")); err != nil {
+		t.Errorf("destination path removed (%v)", err)
+	}
+}
+
+func TestCreateWithParentsAfterPrune(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a", "b", "file")
+
+	calls := 0
+	err := createWithParents(path, func() error {
+		calls++
+		if calls == 1 {
+			// Delete of the last file in a/b by another worker prunes it before the file is written
+			if err := os.Remove(filepath.Dir(path)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return os.WriteFile(path, nil, 0666)
+	})
+
+	if err != nil || calls != 2 {
+		t.Errorf("got %v after %d calls", err, calls)
+	}
+
+	// Other errors are not retried
+	calls = 0
+	err = createWithParents(path, func() error {
+		calls++
+		return os.ErrPermission
+	})
+	if err != os.ErrPermission || calls != 1 {
+		t.Errorf("got %v after %d calls", err, calls)
+	}
+}
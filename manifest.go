@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// manifestEntry : record of one object created by a run
+type manifestEntry struct {
+	Path   string    `json:"path"`
+	Type   string    `json:"type"`
+	Size   int64     `json:"size"`
+	MD5    string    `json:"md5,omitempty"`
+	Tier   string    `json:"tier,omitempty"`
+	ETag   string    `json:"etag,omitempty"`
+	Status string    `json:"status"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// Columns of the manifest in CSV format
+var manifestColumns = []string{"path", "type", "size", "md5", "tier", "etag", "status", "start", "end", "error"}
+
+// isCSVManifest : format of manifest is picked from extension of the file, JSONL unless it is .csv
+func isCSVManifest(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ".csv")
+}
+
+// -------------------------------------------------------------------
+// manifestWriter : writes one entry per object, shared by all workers
+type manifestWriter struct {
+	sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+	csv    *csv.Writer
+}
+
+// newManifestWriter : create the manifest, or keep adding to it when a run is resumed
+func newManifestWriter(path string, resume bool) (*manifestWriter, error) {
+	f, err := openForResume(path, resume)
+	if err != nil {
+		return nil, err
+	}
+
+	mw := &manifestWriter{file: f, writer: bufio.NewWriter(f)}
+	if isCSVManifest(path) {
+		mw.csv = csv.NewWriter(mw.writer)
+
+		info, err := f.Stat()
+		if err == nil && info.Size() == 0 {
+			err = mw.csv.Write(manifestColumns)
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	return mw, nil
+}
+
+func (mw *manifestWriter) Write(e *manifestEntry) error {
+	mw.Lock()
+	defer mw.Unlock()
+
+	if mw.csv != nil {
+		return mw.csv.Write([]string{
+			e.Path, e.Type, strconv.FormatInt(e.Size, 10), e.MD5, e.Tier, e.ETag, e.Status,
+			e.Start.Format(time.RFC3339Nano), e.End.Format(time.RFC3339Nano), e.Error,
+		})
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = mw.writer.Write(append(data, '\n'))
+	return err
+}
+
+// Sync : make entries written so far durable, journal does this before recording items as done
+func (mw *manifestWriter) Sync() error {
+	mw.Lock()
+	defer mw.Unlock()
+
+	if mw.file == nil {
+		// Closed already, which made everything durable
+		return nil
+	}
+
+	err := mw.flush()
+	if err != nil {
+		return err
+	}
+	return mw.file.Sync()
+}
+
+func (mw *manifestWriter) flush() error {
+	if mw.csv != nil {
+		mw.csv.Flush()
+		if err := mw.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return mw.writer.Flush()
+}
+
+func (mw *manifestWriter) Close() error {
+	mw.Lock()
+	defer mw.Unlock()
+
+	f := mw.file
+	mw.file = nil
+
+	err := mw.flush()
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// -------------------------------------------------------------------
+
+// readManifest : call fn with each entry of the manifest in the order they were written
+func readManifest(path string, fn func(e *manifestEntry)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if isCSVManifest(path) {
+		return readCSVManifest(path, f, fn)
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		e := &manifestEntry{}
+		err = json.Unmarshal(scanner.Bytes(), e)
+		if err != nil {
+			return fmt.Errorf("invalid entry at %s:%d (%s)", path, line, err.Error())
+		}
+		fn(e)
+	}
+
+	return scanner.Err()
+}
+
+func readCSVManifest(path string, r io.Reader, fn func(e *manifestEntry)) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(manifestColumns)
+
+	// Header row is skipped
+	_, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("invalid manifest %s (%s)", path, err.Error())
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("invalid manifest %s (%s)", path, err.Error())
+		}
+
+		e := &manifestEntry{Path: record[0], Type: record[1], MD5: record[3], Tier: record[4], ETag: record[5], Status: record[6], Error: record[9]}
+		e.Size, err = strconv.ParseInt(record[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid size %s of %s in %s", record[2], e.Path, path)
+		}
+
+		// Timestamps are informational so entries without them are still usable
+		e.Start, _ = time.Parse(time.RFC3339Nano, record[7])
+		e.End, _ = time.Parse(time.RFC3339Nano, record[8])
+		fn(e)
+	}
+}
+
+// -------------------------------------------------------------------
+
+// recordUpload : add outcome of uploading the job to the manifest
+// Properties are read back so that manifest holds what storage actually has, not what was asked for
+// This lookup is bookkeeping so it goes to the backend directly, keeping it out of stats and report
+func recordUpload(ctx context.Context, job *workItem, start time.Time, uploadErr error) {
+	e := &manifestEntry{
+		Path:   job.path,
+		Type:   job.objtype.String(),
+		Status: job.status.String(),
+		Start:  start.UTC(),
+		End:    time.Now().UTC(),
+	}
+
+	if job.objtype == EObjectType.FILE() {
+		e.Size = kalpavriksha.dataSrc.GetSize(job.path)
+	}
+
+	if uploadErr != nil {
+		e.Error = uploadErr.Error()
+	} else if job.objtype == EObjectType.FILE() {
+		opCtx, cancel := withOpTimeout(ctx)
+		prop, err := kalpavriksha.backend.GetProperties(opCtx, job.path)
+		cancel()
+
+		if err == nil {
+			if prop.ContentLength != nil {
+				e.Size = *prop.ContentLength
+			}
+			if prop.ContentMD5 != nil {
+				e.MD5 = hex.EncodeToString(prop.ContentMD5)
+			}
+			if prop.AccessTier != nil {
+				e.Tier = *prop.AccessTier
+			}
+			if prop.ETag != nil {
+				e.ETag = string(*prop.ETag)
+			}
+		} else {
+			e.Error = fmt.Sprintf("failed to get properties (%s)", err.Error())
+		}
+	}
+
+	err := kalpavriksha.manifest.Write(e)
+	if err != nil {
+		log.Printf("Failed to write manifest entry for %s (%s)\n", job.path, err.Error())
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordUploadIsNotTimed(t *testing.T) {
+	defer func() {
+		kalpavriksha.backend, kalpavriksha.storage, kalpavriksha.dataSrc, kalpavriksha.manifest = nil, nil, nil, nil
+	}()
+
+	ms := newTestMemoryStorage(t, "", "a/file")
+	stats := newStatsCollector()
+	kalpavriksha.backend = ms
+	kalpavriksha.storage = &statsStorage{Storage: ms, stats: stats}
+	kalpavriksha.dataSrc = &zeroDataSource{dataSizeConfig: dataSizeConfig{dist: &fixedSize{size: 1024}}}
+
+	path := filepath.Join(t.TempDir(), "manifest.jsonl")
+	mw, err := newManifestWriter(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kalpavriksha.manifest = mw
+
+	job := &workItem{path: "a/file", objtype: EObjectType.FILE(), status: EJobStatusType.SUCCESS()}
+	recordUpload(context.Background(), job, time.Now(), nil)
+	if err = mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []*manifestEntry{}
+	err = readManifest(path, func(e *manifestEntry) { entries = append(entries, e) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Size comes from the properties of the stored file, not from the data source
+	if len(entries) != 1 || entries[0].Size != int64(len("a/file")) || entries[0].ETag == "" || entries[0].Error != "" {
+		t.Fatalf("manifest has %+v", entries)
+	}
+
+	if len(stats.total) != 0 || stats.inflight != 0 {
+		t.Errorf("properties lookup of manifest was counted in stats, %d ops and %d inflight", len(stats.total), stats.inflight)
+	}
+}
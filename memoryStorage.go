@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+)
+
+type memoryBlob struct {
+	data         []byte
+	md5sum       []byte
+	metadata     map[string]*string
+	tier         blob.AccessTier
+	lastModified time.Time
+	etag         azcore.ETag
+}
+
+// MemoryStorage : keeps everything in process memory, used for dry runs and hermetic testing
+type MemoryStorage struct {
+	StorageConfig
+
+	sync.RWMutex
+	blobs    map[string]*memoryBlob         // Blob name to its content
+	children map[string]map[string]struct{} // Virtual directory ("" or "a/b/") to its immediate children
+	etagSeq  uint64                         // Counter used to generate unique etags
+}
+
+func (ms *MemoryStorage) Init() error {
+	ms.blobs = make(map[string]*memoryBlob)
+	ms.children = make(map[string]map[string]struct{})
+	return nil
+}
+
+func (ms *MemoryStorage) TestConnection(ctx context.Context) error {
+	return nil
+}
+
+// getName : convert the given name to blob name including destination path
+func (ms *MemoryStorage) getName(name string) string {
+	if ms.DestinationPath == "" {
+		return name
+	}
+	return strings.TrimSuffix(ms.DestinationPath, "/") + "/" + name
+}
+
+// addToIndex : register blob and all its parent directories in the hierarchy index
+func (ms *MemoryStorage) addToIndex(name string) {
+	parent := ""
+	child := name
+	for {
+		idx := strings.Index(child, "/")
+		entry := child
+		if idx >= 0 {
+			entry = child[:idx+1]
+		}
+
+		if ms.children[parent] == nil {
+			ms.children[parent] = make(map[string]struct{})
+		}
+		ms.children[parent][entry] = struct{}{}
+
+		if idx < 0 {
+			return
+		}
+		parent += entry
+		child = child[idx+1:]
+	}
+}
+
+// removeFromIndex : remove the blob and prune virtual directories which become empty
+func (ms *MemoryStorage) removeFromIndex(name string) {
+	for {
+		idx := strings.LastIndex(strings.TrimSuffix(name, "/"), "/")
+		parent := name[:idx+1]
+		entry := name[idx+1:]
+
+		delete(ms.children[parent], entry)
+		if len(ms.children[parent]) > 0 || parent == "" {
+			return
+		}
+
+		delete(ms.children, parent)
+		name = parent
+	}
+}
+
+func (ms *MemoryStorage) nextETag() azcore.ETag {
+	ms.etagSeq++
+	return azcore.ETag(fmt.Sprintf("\"0x%X\"", ms.etagSeq))
+}
+
+func (ms *MemoryStorage) UploadData(ctx context.Context, name string, data []byte, o *UploadOptions) error {
+	b := &memoryBlob{
+		data:         data,
+		tier:         blob.AccessTierHot,
+		lastModified: time.Now(),
+	}
+
+	if o != nil {
+		if o.MD5Sum != nil {
+			if !bytes.Equal(getMD5Sum(data), o.MD5Sum) {
+				return newStorageError(http.MethodPut, name, http.StatusBadRequest, bloberror.MD5Mismatch)
+			}
+			b.md5sum = o.MD5Sum
+		}
+
+		if o.Tier != nil {
+			b.tier = *o.Tier
+		}
+	}
+
+	blobName := ms.getName(name)
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	b.etag = ms.nextETag()
+	ms.blobs[blobName] = b
+	ms.addToIndex(blobName)
+	return nil
+}
+
+// UploadStream : memory storage holds complete content anyway so the stream is read in full
+func (ms *MemoryStorage) UploadStream(ctx context.Context, name string, r io.ReaderAt, size int64, o *UploadOptions) error {
+	data := make([]byte, size)
+	n, err := r.ReadAt(data, 0)
+	if int64(n) < size {
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	return ms.UploadData(ctx, name, data, o)
+}
+
+func (ms *MemoryStorage) DownloadData(ctx context.Context, name string, offset int64, count int64) ([]byte, error) {
+	blobName := ms.getName(name)
+
+	ms.RLock()
+	defer ms.RUnlock()
+
+	b, ok := ms.blobs[blobName]
+	if !ok {
+		return nil, newStorageError(http.MethodGet, blobName, http.StatusNotFound, bloberror.BlobNotFound)
+	}
+
+	size := int64(len(b.data))
+	if offset > size {
+		return nil, newStorageError(http.MethodGet, blobName, http.StatusRequestedRangeNotSatisfiable, bloberror.InvalidRange)
+	}
+
+	end := size
+	if count > 0 && offset+count < size {
+		end = offset + count
+	}
+
+	// Content is never modified in place but copy it so that caller owns what it gets
+	data := make([]byte, end-offset)
+	copy(data, b.data[offset:end])
+	return data, nil
+}
+
+func (ms *MemoryStorage) Delete(ctx context.Context, name string, o *DeleteOptions) error {
+	blobName := ms.getName(name)
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	if _, ok := ms.blobs[blobName]; !ok {
+		return newStorageError(http.MethodDelete, blobName, http.StatusNotFound, bloberror.BlobNotFound)
+	}
+
+	delete(ms.blobs, blobName)
+	ms.removeFromIndex(blobName)
+	return nil
+}
+
+func (ms *MemoryStorage) SetTier(ctx context.Context, name string, tier blob.AccessTier) error {
+	blobName := ms.getName(name)
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	b, ok := ms.blobs[blobName]
+	if !ok {
+		return newStorageError(http.MethodPut, blobName, http.StatusNotFound, bloberror.BlobNotFound)
+	}
+
+	b.tier = tier
+	return nil
+}
+
+func (ms *MemoryStorage) CreateStub(ctx context.Context, name string) error {
+	blobName := ms.getName(name)
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	if _, ok := ms.blobs[blobName]; ok {
+		return newStorageError(http.MethodPut, blobName, http.StatusConflict, bloberror.BlobAlreadyExists)
+	}
+
+	ms.blobs[blobName] = &memoryBlob{
+		metadata:     map[string]*string{"hdi_isfolder": to.Ptr("true")},
+		tier:         blob.AccessTierHot,
+		lastModified: time.Now(),
+		etag:         ms.nextETag(),
+	}
+	ms.addToIndex(blobName)
+	return nil
+}
+
+func (ms *MemoryStorage) ListBlobs(name string) *runtime.Pager[container.ListBlobsHierarchyResponse] {
+	listPath := ms.DestinationPath
+	if listPath != "" {
+		listPath += "/"
+	}
+	listPath += name
+
+	// Prefix may end in a partial name so look at the parent and filter on the remaining part
+	idx := strings.LastIndex(listPath, "/")
+	parent := listPath[:idx+1]
+	namePart := listPath[idx+1:]
+
+	ms.RLock()
+	defer ms.RUnlock()
+
+	entries := make([]string, 0, len(ms.children[parent]))
+	for entry := range ms.children[parent] {
+		if strings.HasPrefix(entry, namePart) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Strings(entries)
+
+	items := make([]*container.BlobItem, 0)
+	prefixes := make([]*container.BlobPrefix, 0)
+	for _, entry := range entries {
+		if strings.HasSuffix(entry, "/") {
+			prefixes = append(prefixes, &container.BlobPrefix{Name: to.Ptr(parent + entry)})
+			continue
+		}
+
+		b := ms.blobs[parent+entry]
+		items = append(items, &container.BlobItem{
+			Name:     to.Ptr(parent + entry),
+			Metadata: b.metadata,
+			Properties: &container.BlobProperties{
+				ContentLength: to.Ptr(int64(len(b.data))),
+				ContentMD5:    b.md5sum,
+				AccessTier:    to.Ptr(b.tier),
+				LastModified:  to.Ptr(b.lastModified),
+				ETag:          to.Ptr(b.etag),
+			},
+		})
+	}
+
+	return newStaticListPager(listPath, items, prefixes)
+}
+
+func (ms *MemoryStorage) GetProperties(ctx context.Context, name string) (blob.GetPropertiesResponse, error) {
+	blobName := ms.getName(name)
+
+	ms.RLock()
+	defer ms.RUnlock()
+
+	b, ok := ms.blobs[blobName]
+	if !ok {
+		return blob.GetPropertiesResponse{}, newStorageError(http.MethodHead, blobName, http.StatusNotFound, bloberror.BlobNotFound)
+	}
+
+	return blob.GetPropertiesResponse{
+		ContentLength: to.Ptr(int64(len(b.data))),
+		ContentMD5:    b.md5sum,
+		AccessTier:    to.Ptr(string(b.tier)),
+		LastModified:  to.Ptr(b.lastModified),
+		ETag:          to.Ptr(b.etag),
+		Metadata:      b.metadata,
+	}, nil
+}
+
+// Dump : write name, size, tier, md5sum and metadata of every blob held in memory
+func (ms *MemoryStorage) Dump(w io.Writer) error {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	names := make([]string, 0, len(ms.blobs))
+	for name := range ms.blobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	totalSize := int64(0)
+	for _, name := range names {
+		b := ms.blobs[name]
+		totalSize += int64(len(b.data))
+
+		meta := make([]string, 0, len(b.metadata))
+		for k, v := range b.metadata {
+			meta = append(meta, k+"="+*v)
+		}
+		sort.Strings(meta)
+
+		_, err := fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", name, len(b.data), b.tier,
+			hex.EncodeToString(b.md5sum), strings.Join(meta, ","))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "Total blobs %d, total size %d bytes\n", len(names), totalSize)
+	return err
+}
+
+// DumpToFile : dump contents of memory storage to the given file
+func (ms *MemoryStorage) DumpToFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return ms.Dump(f)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func newTestMemoryStorage(t *testing.T, dstPath string, names ...string) *MemoryStorage {
+	ms := &MemoryStorage{}
+	ms.DestinationPath = dstPath
+	if err := ms.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range names {
+		if err := ms.UploadData(context.Background(), name, []byte(name), nil); err != nil {
+			t.Fatalf("failed to upload %s : %v", name, err)
+		}
+	}
+	return ms
+}
+
+// listNames : prefixes and blobs listed under given prefix across all pages, as "a/ b/ file"
+func listNames(t *testing.T, ms *MemoryStorage, prefix string) string {
+	names := []string{}
+	pager := ms.ListBlobs(prefix)
+	for pager.More() {
+		page, err := pager.NextPage(context.Background())
+		if err != nil {
+			t.Fatalf("failed to list %s : %v", prefix, err)
+		}
+		for _, p := range page.Segment.BlobPrefixes {
+			names = append(names, *p.Name)
+		}
+		for _, b := range page.Segment.BlobItems {
+			names = append(names, *b.Name)
+		}
+	}
+	return strings.Join(names, " ")
+}
+
+func TestMemoryStorageListBlobs(t *testing.T) {
+	ms := newTestMemoryStorage(t, "", "a/1/x", "a/1/y", "a/2/z", "a/w", "b/v", "top")
+
+	// Directories come first, then the blobs, each sorted
+	if got := listNames(t, ms, ""); got != "a/ b/ top" {
+		t.Errorf("root listed %q", got)
+	}
+	if got := listNames(t, ms, "a/"); got != "a/1/ a/2/ a/w" {
+		t.Errorf("a/ listed %q", got)
+	}
+	if got := listNames(t, ms, "a/1/"); got != "a/1/x a/1/y" {
+		t.Errorf("a/1/ listed %q", got)
+	}
+
+	// Prefix may end in a partial name
+	if got := listNames(t, ms, "t"); got != "top" {
+		t.Errorf("t listed %q", got)
+	}
+	if got := listNames(t, ms, "missing/"); got != "" {
+		t.Errorf("missing/ listed %q", got)
+	}
+}
+
+func TestMemoryStorageListBlobsPages(t *testing.T) {
+	names := make([]string, listMaxResults+10)
+	for i := range names {
+		names[i] = fmt.Sprintf("d/file-%d", i)
+	}
+	ms := newTestMemoryStorage(t, "dst", names...)
+
+	if got := strings.Count(listNames(t, ms, "d/"), "dst/d/file-"); got != len(names) {
+		t.Errorf("listed %d files across pages, expected %d", got, len(names))
+	}
+}
+
+func TestMemoryStorageDelete(t *testing.T) {
+	ctx := context.Background()
+	ms := newTestMemoryStorage(t, "dst", "a/1/x", "a/1/y", "a/w")
+
+	if err := ms.Delete(ctx, "a/1/x", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ms.GetProperties(ctx, "a/1/x"); !isNotFoundError(err) {
+		t.Errorf("a/1/x still exists after delete")
+	}
+	if err := ms.Delete(ctx, "a/1/x", nil); !isNotFoundError(err) {
+		t.Errorf("second delete of a/1/x gave %v", err)
+	}
+	if got := listNames(t, ms, "a/"); got != "dst/a/1/ dst/a/w" {
+		t.Errorf("a/ listed %q", got)
+	}
+
+	// Directory goes away along with its last blob
+	if err := ms.Delete(ctx, "a/1/y", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := listNames(t, ms, "a/"); got != "dst/a/w" {
+		t.Errorf("a/ listed %q", got)
+	}
+
+	if err := ms.Delete(ctx, "a/w", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := listNames(t, ms, ""); got != "" {
+		t.Errorf("storage not empty after deleting everything, listed %q", got)
+	}
+}
+
+func TestMemoryStorageDownloadRange(t *testing.T) {
+	ctx := context.Background()
+	ms := newTestMemoryStorage(t, "", "0123456789")
+
+	read := func(offset int64, count int64) string {
+		data, err := ms.DownloadData(ctx, "0123456789", offset, count)
+		if err != nil {
+			t.Fatalf("range %d+%d : %v", offset, count, err)
+		}
+		return string(data)
+	}
+
+	if got := read(0, 0); got != "0123456789" {
+		t.Errorf("count 0 read %q", got)
+	}
+	if got := read(0, 1); got != "0" {
+		t.Errorf("first byte read %q", got)
+	}
+	if got := read(3, 4); got != "3456" {
+		t.Errorf("range 3+4 read %q", got)
+	}
+	if got := read(8, 10); got != "89" {
+		t.Errorf("range past the end read %q", got)
+	}
+
+	if _, err := ms.DownloadData(ctx, "0123456789", 11, 1); err == nil {
+		t.Errorf("range after the end should fail")
+	}
+}
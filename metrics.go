@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Number of times a storage call was retried by the SDK, counted from its retry policy logs
+var storageRetries int64
+
+// Upper bounds in seconds of the latency buckets exported to Prometheus
+var metricsLatencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// registerMetrics : serve /metrics in Prometheus text format on the same server as pprof
+// Called once job queues are created as their depth is part of the metrics
+func registerMetrics() {
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w)
+	})
+}
+
+// escapeLabel : label values are quoted so backslash, quote and new line need escaping
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func writeMetricHeader(w io.Writer, name string, kind string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeLatencyHistogram : cumulative count of calls at each bucket bound, taken from the log-linear histogram
+func writeLatencyHistogram(w io.Writer, name string, op string, h *histogram) {
+	idx := 0
+	cumulative := uint64(0)
+	for _, le := range metricsLatencyBuckets {
+		limit := uint64(le * 1e6)
+		for idx < len(h.counts) && getHistValue(idx) <= limit {
+			cumulative += h.counts[idx]
+			idx++
+		}
+		fmt.Fprintf(w, "%s_bucket{op=\"%s\",le=\"%s\"} %d\n", name, op, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{op=\"%s\",le=\"+Inf\"} %d\n", name, op, h.count)
+	fmt.Fprintf(w, "%s_sum{op=\"%s\"} %g\n", name, op, float64(h.sum)/1e6)
+	fmt.Fprintf(w, "%s_count{op=\"%s\"} %d\n", name, op, h.count)
+}
+
+func writeMetrics(w io.Writer) {
+	sc := kalpavriksha.stats
+
+	sc.Lock()
+	ops := summarize(sc.total)
+	types := getOpTypes(sc.total)
+
+	writeMetricHeader(w, "kalpavriksha_operations_total", "counter", "Storage calls completed successfully, by operation and size bucket")
+	for _, op := range types {
+		for bucket := 0; bucket <= len(sizeBucketLimits); bucket++ {
+			if s, ok := sc.total[statsKey{op: op, bucket: bucket}]; ok {
+				fmt.Fprintf(w, "kalpavriksha_operations_total{op=\"%s\",size=\"%s\"} %d\n", getOpName(op), getSizeBucketName(bucket), s.latency.count)
+			}
+		}
+	}
+
+	writeMetricHeader(w, "kalpavriksha_bytes_total", "counter", "Bytes transferred by successful storage calls, by operation")
+	for _, op := range types {
+		fmt.Fprintf(w, "kalpavriksha_bytes_total{op=\"%s\"} %d\n", getOpName(op), ops[op].bytes)
+	}
+
+	writeMetricHeader(w, "kalpavriksha_errors_total", "counter", "Failed storage calls, by operation and error code")
+	for key, count := range sc.errors {
+		fmt.Fprintf(w, "kalpavriksha_errors_total{op=\"%s\",code=\"%s\"} %d\n", getOpName(key.op), escapeLabel(key.code), count)
+	}
+
+	writeMetricHeader(w, "kalpavriksha_operation_duration_seconds", "histogram", "Latency of successful storage calls, by operation")
+	for _, op := range types {
+		writeLatencyHistogram(w, "kalpavriksha_operation_duration_seconds", getOpName(op), ops[op].latency)
+	}
+	sc.Unlock()
+
+	writeMetricHeader(w, "kalpavriksha_retries_total", "counter", "Storage calls retried by the Azure SDK retry policy")
+	fmt.Fprintf(w, "kalpavriksha_retries_total %d\n", atomic.LoadInt64(&storageRetries))
+
+	writeMetricHeader(w, "kalpavriksha_inflight_operations", "gauge", "Storage calls started but not yet completed")
+	fmt.Fprintf(w, "kalpavriksha_inflight_operations %d\n", atomic.LoadInt64(&sc.inflight))
+
+	writeMetricHeader(w, "kalpavriksha_workers", "gauge", "Number of workers started for the run")
+	fmt.Fprintf(w, "kalpavriksha_workers %d\n", config.Parallelism)
+
+	writeMetricHeader(w, "kalpavriksha_busy_workers", "gauge", "Workers currently working on an item")
+	fmt.Fprintf(w, "kalpavriksha_busy_workers %d\n", int64(config.Parallelism)-atomic.LoadInt64(&WaitCount))
+
+	writeMetricHeader(w, "kalpavriksha_queue_depth", "gauge", "Items waiting in the jobs and results queues")
+	fmt.Fprintf(w, "kalpavriksha_queue_depth{queue=\"jobs\"} %d\n", len(kalpavriksha.jobs))
+	fmt.Fprintf(w, "kalpavriksha_queue_depth{queue=\"results\"} %d\n", len(kalpavriksha.results))
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"math"
+	"math/rand"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Salts of the random streams used by mixed workload
+const (
+	mixOpSalt     uint64 = 0x3c3c3c3c3c3c3c3c
+	mixTargetSalt uint64 = 0x7a7a7a7a7a7a7a7a
+)
+
+// Number of random objects tried to find one in the state an operation needs
+const mixPickTries = 64
+
+// Operations a mix can be made of and the storage operation each one performs
+var mixOpNames = map[string]OpType{
+	"read":   EOpType.DOWNLOAD(),
+	"write":  EOpType.UPLOAD(),
+	"stat":   EOpType.GET_PROPERTIES(),
+	"delete": EOpType.DELETE(),
+	"list":   EOpType.LIST(),
+}
+
+// State of each object of the data set while the mix runs
+const (
+	objAbsent  int32 = iota // Deleted by the mix, can be written again
+	objPresent              // Can be read, listed, overwritten or deleted
+	objBusy                 // Being written or deleted by a worker
+)
+
+// Used when no object is in the state an operation needs, e.g. everything has been deleted
+var errNoObject = errors.New("no object available")
+
+// mixWeight : share of one operation in the mix, weights are kept cumulative and normalised to 1
+type mixWeight struct {
+	op     OpType
+	weight float64
+}
+
+// parseMix : weights of operations e.g. read=60,write=25,stat=10,delete=5
+func parseMix(s string) ([]mixWeight, error) {
+	mix := []mixWeight{}
+	total := float64(0)
+
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+
+		k, v, ok := strings.Cut(part, "=")
+		k = strings.ToLower(strings.TrimSpace(k))
+		if !ok {
+			return nil, fmt.Errorf("operation %s is not of form <op>=<weight>", part)
+		}
+
+		op, ok := mixOpNames[k]
+		if !ok {
+			return nil, fmt.Errorf("unknown operation %s, expected one of read / write / stat / delete / list", k)
+		}
+
+		weight, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || math.IsNaN(weight) || math.IsInf(weight, 0) || weight < 0 {
+			return nil, fmt.Errorf("weight of %s should be a non negative number", k)
+		}
+
+		total += weight
+		mix = append(mix, mixWeight{op: op, weight: total})
+	}
+
+	if total <= 0 {
+		return nil, fmt.Errorf("mix needs at least one operation with positive weight")
+	}
+
+	for i := range mix {
+		mix[i].weight /= total
+	}
+	return mix, nil
+}
+
+// validateMix : mixed workload runs over an existing data set so it replaces the single task modes
+func validateMix() error {
+	if config.MixStr == "" {
+		return nil
+	}
+
+	var err error
+	config.Mix, err = parseMix(config.MixStr)
+	if err != nil {
+		return fmt.Errorf("invalid mix : %s", err.Error())
+	}
+
+	if config.Delete || config.SetTier || config.Verify || config.Stat || config.CreateStub || config.DeleteStub {
+		return fmt.Errorf("mix can not be used along with delete, set-tier, verify, stat or stub modes")
+	}
+
+	if config.ManifestOutPath != "" {
+		return fmt.Errorf("manifest-out can not be used with mix as objects are overwritten and deleted")
+	}
+
+	if config.MixOps < 0 {
+		return fmt.Errorf("mix ops can not be negative")
+	}
+
+	return nil
+}
+
+// -------------------------------------------------------------------
+
+// mixedWorkload : weighted mix of operations over objects of a pre-populated data set
+type mixedWorkload struct {
+	names []string // Files of the data set
+	sizes []int64  // Size of each file, used by ranged reads
+	state []int32  // State of each file, see objPresent
+}
+
+// newMixedWorkload : collect files of the data set, all of them are expected to exist when the mix starts
+func newMixedWorkload() (*mixedWorkload, error) {
+	m := &mixedWorkload{}
+	forEachJob(func(job workItem) {
+		if job.objtype == EObjectType.FILE() {
+			m.names = append(m.names, job.path)
+			m.sizes = append(m.sizes, getJobFileSize(&job))
+		}
+	})
+
+	if len(m.names) == 0 {
+		return nil, fmt.Errorf("data set has no files for the mix to work on")
+	}
+
+	m.state = make([]int32, len(m.names))
+	for i := range m.state {
+		m.state[i] = objPresent
+	}
+	return m, nil
+}
+
+// getOpsPerPass : operations started in one pass, by default as many as files in the data set
+func (m *mixedWorkload) getOpsPerPass() int64 {
+	if config.MixOps > 0 {
+		return config.MixOps
+	}
+	return int64(len(m.names))
+}
+
+// pickOp : operation of the given position in the mix, same seed gives same sequence of operations
+func (m *mixedWorkload) pickOp(seq int64) OpType {
+	u := float64(splitmix64(uint64(config.Seed)^mixOpSalt+uint64(seq))>>11) / (1 << 53)
+	for _, w := range config.Mix {
+		if u < w.weight {
+			return w.op
+		}
+	}
+	return config.Mix[len(config.Mix)-1].op
+}
+
+// forEachJob : call fn with each operation of given pass, object is picked by the worker running it
+func (m *mixedWorkload) forEachJob(pass int64, fn func(job workItem)) {
+	count := m.getOpsPerPass()
+	for i := int64(0); i < count; i++ {
+		fn(workItem{op: m.pickOp(pass*count + i), objtype: EObjectType.FILE(), status: EJobStatusType.WAIT()})
+	}
+}
+
+// pick : random object whose state is accepted by the operation, -1 if none was found
+func (m *mixedWorkload) pick(rng *rand.Rand, accept func(state int32) bool) int {
+	for i := 0; i < mixPickTries; i++ {
+		idx := rng.Intn(len(m.names))
+		if accept(atomic.LoadInt32(&m.state[idx])) {
+			return idx
+		}
+	}
+	return -1
+}
+
+// acquire : mark a random object busy for write or delete and return it with the state it was in,
+// -1 if none was found
+func (m *mixedWorkload) acquire(rng *rand.Rand, from ...int32) (int, int32) {
+	for i := 0; i < mixPickTries; i++ {
+		idx := rng.Intn(len(m.names))
+		for _, state := range from {
+			if atomic.CompareAndSwapInt32(&m.state[idx], state, objBusy) {
+				return idx, state
+			}
+		}
+	}
+	return -1, objAbsent
+}
+
+// isMissing : object does not exist, local storage reports it as a plain file system error
+func isMissing(err error) bool {
+	return isNotFoundError(err) || errors.Is(err, fs.ErrNotExist)
+}
+
+// markIfMissing : object expected to exist was not found, later reads skip it till a write creates it again
+func (m *mixedWorkload) markIfMissing(idx int, err error) {
+	if isMissing(err) {
+		atomic.CompareAndSwapInt32(&m.state[idx], objPresent, objAbsent)
+	}
+}
+
+// run : perform the operation of the job on an object in the right state, path of the job is set to that object
+func (m *mixedWorkload) run(ctx context.Context, rng *rand.Rand, job *workItem) error {
+	isPresent := func(state int32) bool { return state == objPresent }
+
+	switch job.op {
+	case EOpType.UPLOAD():
+		// Writes overwrite existing objects and create again the ones deleted earlier
+		idx, prev := m.acquire(rng, objPresent, objAbsent)
+		if idx < 0 {
+			return errNoObject
+		}
+		job.path = m.names[idx]
+
+		var err error
+		if config.BlockSize > 0 {
+			err = uploadFileStream(ctx, job.path)
+		} else {
+			err = uploadFile(ctx, job.path)
+		}
+
+		// Uploads are committed in one go so a failed one leaves the object as it was
+		if err != nil {
+			atomic.StoreInt32(&m.state[idx], prev)
+		} else {
+			atomic.StoreInt32(&m.state[idx], objPresent)
+		}
+		return err
+
+	case EOpType.DELETE():
+		idx, _ := m.acquire(rng, objPresent)
+		if idx < 0 {
+			return errNoObject
+		}
+		job.path = m.names[idx]
+
+		err := kalpavriksha.storage.Delete(ctx, job.path, nil)
+		if err == nil || isMissing(err) {
+			atomic.StoreInt32(&m.state[idx], objAbsent)
+		} else {
+			atomic.StoreInt32(&m.state[idx], objPresent)
+		}
+		return err
+
+	case EOpType.DOWNLOAD():
+		idx := m.pick(rng, isPresent)
+		if idx < 0 {
+			return errNoObject
+		}
+		job.path = m.names[idx]
+
+		err := readFile(ctx, rng, job.path, m.sizes[idx])
+		m.markIfMissing(idx, err)
+		return err
+
+	case EOpType.GET_PROPERTIES():
+		idx := m.pick(rng, isPresent)
+		if idx < 0 {
+			return errNoObject
+		}
+		job.path = m.names[idx]
+
+		_, err := kalpavriksha.storage.GetProperties(ctx, job.path)
+		m.markIfMissing(idx, err)
+		return err
+
+	case EOpType.LIST():
+		// First page of the directory holding a random object, whatever state it is in
+		idx := m.pick(rng, func(state int32) bool { return true })
+		job.path = ""
+		if dir := path.Dir(m.names[idx]); dir != "." {
+			job.path = dir + "/"
+		}
+
+		pager := kalpavriksha.storage.ListBlobs(job.path)
+		_, err := pager.NextPage(ctx)
+		return err
+	}
+
+	return fmt.Errorf("operation %s is not supported in mix", job.op)
+}
+
+// Workers for mixed workload
+func mixedWorker(ctx context.Context, w int) {
+	defer kalpavriksha.wgWorkers.Done()
+	sched := newWorkerSchedule()
+	rng := rand.New(rand.NewSource(int64(splitmix64(uint64(config.Seed) ^ mixTargetSalt + uint64(w)))))
+
+	for job := range kalpavriksha.jobs {
+		if isWindowOver() {
+			continue
+		}
+
+		jobCtx, ok := startJob(ctx, sched, &job)
+		if !ok {
+			continue
+		}
+
+		job.workerId = w
+		atomic.AddInt64(&WaitCount, -1)
+
+		job.status = EJobStatusType.INPROGRESS()
+
+		opCtx, cancel := withOpTimeout(jobCtx)
+		err := kalpavriksha.mix.run(opCtx, rng, &job)
+		cancel()
+
+		if err == errNoObject {
+			// No storage call was made so this is not a failure, it is reported separately
+			log.Printf("(%d) Skipped %s, %s\n", w, getOpName(job.op), err.Error())
+			job.status = EJobStatusType.SKIPPED()
+		} else if err != nil {
+			log.Printf("(%d) Failed to %s %s (%s)\n", w, getOpName(job.op), job.path, err.Error())
+			job.status = EJobStatusType.FAILED()
+		} else {
+			job.status = EJobStatusType.SUCCESS()
+		}
+
+		atomic.AddInt64(&WaitCount, 1)
+		kalpavriksha.results <- job
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// failingStorage : every upload fails
+type failingStorage struct {
+	Storage
+}
+
+func (f *failingStorage) UploadData(ctx context.Context, name string, data []byte, o *UploadOptions) error {
+	return errors.New("upload failed")
+}
+
+func TestMixFailedWriteKeepsState(t *testing.T) {
+	defer func() {
+		kalpavriksha.storage, kalpavriksha.dataSrc = nil, nil
+	}()
+
+	kalpavriksha.storage = &failingStorage{Storage: newTestMemoryStorage(t, "")}
+	kalpavriksha.dataSrc = &zeroDataSource{dataSizeConfig: dataSizeConfig{dist: &fixedSize{size: 16}}}
+	config.BlockSize = 0
+
+	m := &mixedWorkload{names: []string{"absent", "present"}, sizes: []int64{16, 16}, state: []int32{objAbsent, objPresent}}
+	rng := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 10; i++ {
+		job := &workItem{op: EOpType.UPLOAD()}
+		if err := m.run(context.Background(), rng, job); err == nil {
+			t.Fatalf("write of %s should fail", job.path)
+		}
+	}
+
+	// Deleted object is not created by a failed write so reads still skip it
+	if m.state[0] != objAbsent || m.state[1] != objPresent {
+		t.Errorf("states after failed writes %v", m.state)
+	}
+}
+
+func TestMixNoObject(t *testing.T) {
+	// Deleted objects can be written but not read, busy ones can not be touched at all
+	m := &mixedWorkload{names: []string{"a", "b"}, sizes: []int64{16, 16}, state: []int32{objAbsent, objBusy}}
+	rng := rand.New(rand.NewSource(1))
+
+	for _, op := range []OpType{EOpType.DOWNLOAD(), EOpType.GET_PROPERTIES(), EOpType.DELETE()} {
+		if err := m.run(context.Background(), rng, &workItem{op: op}); err != errNoObject {
+			t.Errorf("%s with nothing to work on gave %v", getOpName(op), err)
+		}
+	}
+
+	m.state[0] = objBusy
+	if err := m.run(context.Background(), rng, &workItem{op: EOpType.UPLOAD()}); err != errNoObject {
+		t.Errorf("write with every object busy gave %v", err)
+	}
+}
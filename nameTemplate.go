@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Salts mixed in the key of a file slot so that uuid and extension do not correlate with each other
+const (
+	uuidSalt uint64 = 0x0123456789abcdef
+	extSalt  uint64 = 0xe8e8e8e8e8e8e8e8
+)
+
+// Default template generating the legacy names like dir-0/1/2/file-5
+const defaultNameTemplate = "{dir}/file-{file}"
+
+// Default layout of {time} token, kept free of characters which are not allowed in local file names
+const defaultNameTimeLayout = "20060102T150405Z"
+
+// nameSlot : position of a file in the data set from which its name is generated
+type nameSlot struct {
+	dir   string // Path of directory holding the file, without trailing '/'
+	level int    // Level of the directory, top level directories being level 1
+	file  int64  // Index of the file in its directory
+	seq   int64  // Index of the file in the data set
+}
+
+// key : random key of the slot, same for a given seed across runs and independent of the template
+func (s *nameSlot) key() uint64 {
+	return seededKey(config.Seed, fmt.Sprintf("%s/file-%d", s.dir, s.file))
+}
+
+// namePart : literal text or a token of the template which expands to part of the name
+type namePart func(s *nameSlot) string
+
+// nameTemplate : compiled naming template for generated files
+type nameTemplate struct {
+	template string
+	parts    []namePart
+	seeded   bool // Names depend on seed
+	timed    bool // Names depend on name time
+}
+
+func (t *nameTemplate) String() string {
+	return t.template
+}
+
+// isUnderDir : each file is generated inside its directory so deleting a directory deletes all of its files
+func (t *nameTemplate) isUnderDir() bool {
+	return strings.HasPrefix(t.template, "{dir}/")
+}
+
+// getName : expand the template for the given slot
+func (t *nameTemplate) getName(s *nameSlot) string {
+	var sb strings.Builder
+	for _, part := range t.parts {
+		sb.WriteString(part(s))
+	}
+
+	// Files directly under root have no directory so drop the separator which followed {dir}
+	return strings.TrimPrefix(sb.String(), "/")
+}
+
+// parseNameTemplate : compile a template like {dir}/{level}/{uuid}.{ext:csv,json,parquet}
+func parseNameTemplate(template string) (*nameTemplate, error) {
+	t := &nameTemplate{template: template}
+
+	// {file} is the index within a directory so it is unique only along with {dir}, and only when some
+	// text other than digits separates the two, else dir-1 with file 23 gives the same name as dir-12 with file 3
+	unique, separated := false, false
+	lastDirOrFile, textSince := "", false
+
+	rest := template
+	for rest != "" {
+		start := strings.Index(rest, "{")
+		if start < 0 {
+			start = len(rest)
+		}
+
+		if strings.Contains(rest[:start], "}") {
+			return nil, fmt.Errorf("unexpected } in %s", template)
+		}
+
+		if start > 0 {
+			t.parts = append(t.parts, literalPart(rest[:start]))
+			if strings.TrimLeft(rest[:start], "0123456789") != "" {
+				textSince = true
+			}
+		}
+
+		if start == len(rest) {
+			break
+		}
+
+		end := strings.Index(rest[start:], "}")
+		if end < 0 || strings.Contains(rest[start+1:start+end], "{") {
+			return nil, fmt.Errorf("missing } in %s", template)
+		}
+
+		token := rest[start+1 : start+end]
+		rest = rest[start+end+1:]
+
+		name, arg, _ := strings.Cut(token, ":")
+		part, err := parseNameToken(t, name, arg)
+		if err != nil {
+			return nil, err
+		}
+
+		switch name {
+		case "dir", "file":
+			if lastDirOrFile != "" && lastDirOrFile != name && textSince {
+				separated = true
+			}
+			lastDirOrFile, textSince = name, false
+		case "n", "uuid":
+			unique = true
+		}
+		t.parts = append(t.parts, part)
+	}
+
+	if !unique && !separated {
+		return nil, fmt.Errorf("template %s needs {dir} and {file} separated by some text, or one of {n} or {uuid} to generate unique names", template)
+	}
+
+	return t, nil
+}
+
+func literalPart(text string) namePart {
+	return func(s *nameSlot) string {
+		return text
+	}
+}
+
+// parseNameToken : build the expansion of a single token
+func parseNameToken(t *nameTemplate, name string, arg string) (namePart, error) {
+	switch name {
+	case "dir":
+		return func(s *nameSlot) string {
+			return s.dir
+		}, nil
+
+	case "level":
+		return func(s *nameSlot) string {
+			return strconv.Itoa(s.level)
+		}, nil
+
+	case "file", "n":
+		// Optional argument is the width to which the counter is zero padded
+		width := 0
+		if arg != "" {
+			w, err := strconv.Atoi(arg)
+			if err != nil || w < 0 {
+				return nil, fmt.Errorf("invalid width %s for {%s}", arg, name)
+			}
+			width = w
+		}
+
+		if name == "file" {
+			return func(s *nameSlot) string {
+				return fmt.Sprintf("%0*d", width, s.file)
+			}, nil
+		}
+		return func(s *nameSlot) string {
+			return fmt.Sprintf("%0*d", width, s.seq)
+		}, nil
+
+	case "uuid":
+		t.seeded = true
+		return func(s *nameSlot) string {
+			return getSlotUUID(s.key())
+		}, nil
+
+	case "hash":
+		// Hash of the default name of the slot, does not depend on seed so it can be used without one
+		length := 8
+		if arg != "" {
+			l, err := strconv.Atoi(arg)
+			if err != nil || l <= 0 || l > 16 {
+				return nil, fmt.Errorf("invalid length %s for {hash}, should be 1 to 16", arg)
+			}
+			length = l
+		}
+		return func(s *nameSlot) string {
+			return fmt.Sprintf("%016x", seededKey(0, fmt.Sprintf("%s/file-%d", s.dir, s.file)))[:length]
+		}, nil
+
+	case "time":
+		t.timed = true
+		layout := defaultNameTimeLayout
+		if arg != "" {
+			layout = arg
+		}
+		return func(s *nameSlot) string {
+			return config.NameTime.Format(layout)
+		}, nil
+
+	case "ext":
+		exts := strings.Split(arg, ",")
+		for _, ext := range exts {
+			if ext == "" {
+				return nil, fmt.Errorf("invalid extension list %s for {ext}", arg)
+			}
+		}
+
+		if len(exts) > 1 {
+			t.seeded = true
+		}
+		return func(s *nameSlot) string {
+			return exts[splitmix64(s.key()^extSalt)%uint64(len(exts))]
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown token {%s}", name)
+}
+
+// getSlotUUID : version 4 style UUID derived from key of the slot
+func getSlotUUID(key uint64) string {
+	hi := splitmix64(key ^ uuidSalt)
+	lo := splitmix64(hi)
+
+	hi = (hi &^ 0xf000) | 0x4000           // Version 4
+	lo = (lo &^ (0x3 << 62)) | (0x2 << 62) // Variant RFC 4122
+	return fmt.Sprintf("%08x-%04x-%04x-%04x-%012x",
+		hi>>32, (hi>>16)&0xffff, hi&0xffff, lo>>48, lo&0xffffffffffff)
+}
+
+// parseNameTime : parse time used by {time} token, given in RFC3339 or as unix seconds
+func parseNameTime(s string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(secs, 0).UTC(), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid name time %s, expected RFC3339 or unix seconds", s)
+	}
+	return t.UTC(), nil
+}
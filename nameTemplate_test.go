@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseNameTemplate(t *testing.T) {
+	valid := []string{
+		defaultNameTemplate,
+		"{dir}/{level}/obj-{file:6}.bin",
+		"obj-{n}",
+		"{n:8}-{hash}",
+		"{uuid}.{ext:csv,json,parquet}",
+		"{time}/{uuid}",
+		"{file}_{dir}",
+		"{dir}{n}{file}",
+	}
+	for _, template := range valid {
+		if _, err := parseNameTemplate(template); err != nil {
+			t.Errorf("%s: %v", template, err)
+		}
+	}
+
+	invalid := []string{
+		// {file} restarts in every directory
+		"file-{file}",
+		"{level}/obj-{file}",
+		"{hash}",
+		"static",
+
+		// dir-1 with file 23 would be named same as dir-12 with file 3
+		"{dir}{file}",
+		"{file}{dir}",
+		"{dir}{level}{file}",
+		"{dir}0{file}",
+		"{dir}/{dir}{file}",
+
+		"{dir}/{file",
+		"{dir}/file}",
+		"{dir}/{unknown}-{file}",
+		"{dir}/{file:x}",
+		"{n}-{hash:17}",
+		"{n}.{ext:}",
+	}
+	for _, template := range invalid {
+		if _, err := parseNameTemplate(template); err == nil {
+			t.Errorf("%s should be rejected", template)
+		}
+	}
+}
+
+func TestNameTemplateGetName(t *testing.T) {
+	nt, err := parseNameTemplate(defaultNameTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := nt.getName(&nameSlot{dir: "dir-0/1", level: 2, file: 5}); name != "dir-0/1/file-5" {
+		t.Errorf("default template gave %s", name)
+	}
+	if name := nt.getName(&nameSlot{file: 3}); name != "file-3" {
+		t.Errorf("default template gave %s for a file under root", name)
+	}
+
+	nt, err = parseNameTemplate("{dir}/{level}/obj-{file:4}-{n:5}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := nt.getName(&nameSlot{dir: "a", level: 1, file: 7, seq: 42}); name != "a/1/obj-0007-00042" {
+		t.Errorf("padded template gave %s", name)
+	}
+}
+
+// Accepted templates give distinct names across directories
+func TestNameTemplateIsUnique(t *testing.T) {
+	for _, template := range []string{defaultNameTemplate, "{dir}-{file}", "obj-{n}", "{level}/{uuid}.{ext:a,b}"} {
+		nt, err := parseNameTemplate(template)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		seen := make(map[string]bool)
+		seq := int64(0)
+		for d := 0; d < 20; d++ {
+			for f := int64(0); f < 20; f++ {
+				name := nt.getName(&nameSlot{dir: fmt.Sprintf("dir-%d", d), level: 1, file: f, seq: seq})
+				if seen[name] {
+					t.Fatalf("%s: %s generated twice", template, name)
+				}
+				seen[name] = true
+				seq++
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/JeffreyRichter/enum/enum"
+)
+
+// Salt mixed in the key of a path so that its shard does not correlate with its content or size
+const shardSalt uint64 = 0x5a5a5a5a5a5a5a5a
+
+// Prefix used by HOT strategy to put the complete data set in a single name range
+const hotPrefix = "hot"
+
+// ------------------------------------------------------------------
+// Prefix strategy deciding the name range in which each generated path lands
+type PrefixStrategy int
+
+var EPrefixStrategy = PrefixStrategy(0).INVALID_PREFIX()
+
+func (PrefixStrategy) INVALID_PREFIX() PrefixStrategy {
+	return PrefixStrategy(0)
+}
+
+// No prefix, sequential names land in the same range
+func (PrefixStrategy) NONE() PrefixStrategy {
+	return PrefixStrategy(1)
+}
+
+// Hash of the path as prefix, spreads paths evenly across ranges
+func (PrefixStrategy) HASH() PrefixStrategy {
+	return PrefixStrategy(2)
+}
+
+// Counter with its digits reversed as prefix, consecutive paths land far apart
+func (PrefixStrategy) REVERSE() PrefixStrategy {
+	return PrefixStrategy(3)
+}
+
+// One of a fixed number of shards picked randomly as prefix
+func (PrefixStrategy) SHARD() PrefixStrategy {
+	return PrefixStrategy(4)
+}
+
+// Same prefix for all paths, deliberately creating a hot range
+func (PrefixStrategy) HOT() PrefixStrategy {
+	return PrefixStrategy(5)
+}
+
+func (f PrefixStrategy) String() string {
+	return enum.StringInt(f, reflect.TypeOf(f))
+}
+
+func (a *PrefixStrategy) Parse(s string) error {
+	enumVal, err := enum.ParseInt(reflect.TypeOf(a), s, true, false)
+	if enumVal != nil {
+		*a = enumVal.(PrefixStrategy)
+	}
+
+	return err
+}
+
+// ------------------------------------------------------------------
+
+// Default length of the prefix for HASH and REVERSE strategies
+const (
+	defaultHashPrefixLen    = 4
+	defaultReversePrefixLen = 8
+)
+
+// getPrefixLen : length of the prefix for the configured strategy
+func getPrefixLen() int {
+	if config.PrefixLen > 0 {
+		return config.PrefixLen
+	}
+
+	if config.PrefixStrategy == EPrefixStrategy.REVERSE() {
+		return defaultReversePrefixLen
+	}
+	return defaultHashPrefixLen
+}
+
+// getPrefix : prefix for the path which is the seq-th entry of the data set
+// Prefix depends only on the path, its position and the seed so delete and verify can regenerate it
+func getPrefix(name string, seq int64) string {
+	switch config.PrefixStrategy {
+	case EPrefixStrategy.HASH():
+		return fmt.Sprintf("%016x", seededKey(0, name))[:getPrefixLen()] + "/"
+
+	case EPrefixStrategy.REVERSE():
+		counter := []byte(fmt.Sprintf("%0*d", getPrefixLen(), seq))
+		for i, j := 0, len(counter)-1; i < j; i, j = i+1, j-1 {
+			counter[i], counter[j] = counter[j], counter[i]
+		}
+		return string(counter) + "/"
+
+	case EPrefixStrategy.SHARD():
+		width := len(strconv.FormatInt(config.PrefixShards-1, 10))
+		shard := splitmix64(seededKey(config.Seed, name)^shardSalt) % uint64(config.PrefixShards)
+		return fmt.Sprintf("shard-%0*d/", width, shard)
+
+	case EPrefixStrategy.HOT():
+		return hotPrefix + "/"
+	}
+
+	return ""
+}
+
+// validatePrefixStrategy : check the prefix related config
+func validatePrefixStrategy() error {
+	err := config.PrefixStrategy.Parse(config.PrefixStrategyStr)
+	if err != nil {
+		return fmt.Errorf("invalid prefix strategy %s", config.PrefixStrategyStr)
+	}
+
+	if config.PrefixLen < 0 || config.PrefixLen > 16 {
+		return fmt.Errorf("prefix length should be between 1 and 16")
+	}
+
+	if config.PrefixStrategy == EPrefixStrategy.SHARD() && config.PrefixShards <= 0 {
+		return fmt.Errorf("number of prefix shards should be more than 0")
+	}
+
+	return nil
+}
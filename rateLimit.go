@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// schedule : open loop schedule where start time of each item is fixed up front from the rate limits,
+// independent of when earlier items complete, so a slow service can not slow down the offered load
+type schedule struct {
+	start    time.Time
+	opsRate  float64 // Items per second, 0 means no limit
+	byteRate float64 // Bytes per second, 0 means no limit
+	count    int64   // Items scheduled so far
+	bytes    int64   // Bytes of items scheduled so far
+}
+
+// newSchedule : schedule for given limits in items/sec and MB/sec, nil when there is no limit
+func newSchedule(opsRate float64, mbRate float64) *schedule {
+	if opsRate <= 0 && mbRate <= 0 {
+		return nil
+	}
+	return &schedule{start: time.Now(), opsRate: opsRate, byteRate: mbRate * 1024 * 1024}
+}
+
+// next : intended start time of the next item, items are due once all earlier ones fit in the limits
+func (s *schedule) next(size int64) time.Time {
+	offset := float64(0)
+	if s.opsRate > 0 {
+		offset = float64(s.count) / s.opsRate
+	}
+	if s.byteRate > 0 {
+		if b := float64(s.bytes) / s.byteRate; b > offset {
+			offset = b
+		}
+	}
+
+	s.count++
+	s.bytes += size
+	return s.start.Add(time.Duration(offset * float64(time.Second)))
+}
+
+// waitUntil : sleep till given time, false if run was stopped or --duration got over meanwhile
+func waitUntil(t time.Time) bool {
+	d := time.Until(t)
+	if d <= 0 {
+		return !isWindowOver()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-kalpavriksha.window.Done():
+		return false
+	}
+}
+
+// isRateLimited : any of the global or per worker limits is given
+func isRateLimited() bool {
+	return config.OpsRate > 0 || config.Bandwidth > 0 || config.WorkerOpsRate > 0 || config.WorkerBandwidth > 0
+}
+
+// getJobBytes : bytes a job moves, counted against bandwidth limits
+func getJobBytes(job *workItem) int64 {
+	// Objects of mixed workload are picked by workers so their size is not known up front
+	if job.objtype != EObjectType.FILE() || !(config.Verify || config.Read || isUploadTask()) {
+		return 0
+	}
+
+	size := getJobFileSize(job)
+	if config.Read {
+		return getReadBytes(size)
+	} else if config.Verify && config.VerifyRanges > 0 && int64(config.VerifyRanges)*verifyRangeSize < size {
+		size = int64(config.VerifyRanges) * verifyRangeSize
+	}
+	return size
+}
+
+// newWorkerSchedule : schedule of a single worker as per the per worker limits, nil when there is none
+func newWorkerSchedule() *schedule {
+	return newSchedule(config.WorkerOpsRate, config.WorkerBandwidth)
+}
+
+// startJob : wait till the job is due as per limits of the worker, false if no new work should be started
+// Returned context carries the intended start of the job for latency measurement, see getOpStart
+func startJob(ctx context.Context, sched *schedule, job *workItem) (context.Context, bool) {
+	intended := job.intended
+	if sched != nil {
+		due := sched.next(getJobBytes(job))
+		if !waitUntil(due) {
+			return ctx, false
+		}
+
+		if due.After(intended) {
+			intended = due
+		}
+	}
+
+	if intended.IsZero() {
+		return ctx, true
+	}
+	return context.WithValue(ctx, intendedStartKey{}, &intendedStart{at: intended}), true
+}
+
+// -------------------------------------------------------------------
+
+type intendedStartKey struct{}
+
+// intendedStart : time at which the schedule wanted a job to start
+type intendedStart struct {
+	at   time.Time
+	used int32 // Set once first storage call of the job has picked it
+}
+
+// getOpStart : time from which latency of a storage call is measured
+// First call of a scheduled job is measured from its intended start, so the time it waited behind
+// slow calls is counted as well instead of being hidden by the schedule slipping (coordinated omission)
+func getOpStart(ctx context.Context) time.Time {
+	now := time.Now()
+	if is, ok := ctx.Value(intendedStartKey{}).(*intendedStart); ok && atomic.CompareAndSwapInt32(&is.used, 0, 1) && is.at.Before(now) {
+		return is.at
+	}
+	return now
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// offsets : time from start of the schedule at which each item of given size is due
+func offsets(s *schedule, sizes ...int64) []time.Duration {
+	due := make([]time.Duration, 0, len(sizes))
+	for _, size := range sizes {
+		due = append(due, s.next(size).Sub(s.start))
+	}
+	return due
+}
+
+func TestSchedule(t *testing.T) {
+	const mb = 1024 * 1024
+	ms := time.Millisecond
+
+	if newSchedule(0, 0) != nil {
+		t.Errorf("schedule without limits should be nil")
+	}
+
+	if due := offsets(newSchedule(100, 0), 0, 0, 0); due[1] != 10*ms || due[2] != 20*ms {
+		t.Errorf("100 ops/sec gave %v", due)
+	}
+
+	// Item is due once the bytes of all earlier ones fit in the bandwidth
+	if due := offsets(newSchedule(0, 10), mb, 2*mb, 0, mb); due[1] != 100*ms || due[2] != 300*ms || due[3] != 300*ms {
+		t.Errorf("10 MB/sec gave %v", due)
+	}
+
+	// With both limits the tighter one decides
+	if due := offsets(newSchedule(100, 10), mb, mb, mb); due[2] != 200*ms {
+		t.Errorf("100 ops/sec and 10 MB/sec gave %v", due)
+	}
+	if due := offsets(newSchedule(10, 100), mb, mb, mb); due[2] != 200*ms {
+		t.Errorf("10 ops/sec and 100 MB/sec gave %v", due)
+	}
+}
+
+// Items are due as per the schedule alone, however late the previous ones were picked
+func TestScheduleIsOpenLoop(t *testing.T) {
+	s := newSchedule(1000, 0)
+	s.start = time.Now().Add(-time.Hour)
+
+	due := offsets(s, 0, 0, 0)
+	if due[0] != 0 || due[1] != time.Millisecond || due[2] != 2*time.Millisecond {
+		t.Errorf("late schedule gave %v", due)
+	}
+}
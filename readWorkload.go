@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/JeffreyRichter/enum/enum"
+)
+
+// Salt of the random stream picking offsets of random reads
+const readOffsetSalt uint64 = 0x4d4d4d4d4d4d4d4d
+
+// ------------------------------------------------------------------
+// Read pattern
+type ReadPattern int
+
+var EReadPattern = ReadPattern(0).INVALID_READ_PATTERN()
+
+func (ReadPattern) INVALID_READ_PATTERN() ReadPattern {
+	return ReadPattern(0)
+}
+
+// Complete file in one call
+func (ReadPattern) FULL() ReadPattern {
+	return ReadPattern(1)
+}
+
+// Complete file front to back in ranges of --read-size
+func (ReadPattern) SEQUENTIAL() ReadPattern {
+	return ReadPattern(2)
+}
+
+// --read-count ranges of --read-size at random offsets
+func (ReadPattern) RANDOM() ReadPattern {
+	return ReadPattern(3)
+}
+
+func (f ReadPattern) String() string {
+	return enum.StringInt(f, reflect.TypeOf(f))
+}
+
+func (a *ReadPattern) Parse(s string) error {
+	enumVal, err := enum.ParseInt(reflect.TypeOf(a), s, true, false)
+	if enumVal != nil {
+		*a = enumVal.(ReadPattern)
+	}
+
+	return err
+}
+
+// ------------------------------------------------------------------
+
+// validateRead : check read pattern, used by --read and by reads of --mix
+func validateRead() error {
+	err := config.ReadPattern.Parse(config.ReadPatternStr)
+	if err != nil || config.ReadPattern == EReadPattern.INVALID_READ_PATTERN() {
+		return fmt.Errorf("invalid read pattern %s", config.ReadPatternStr)
+	}
+
+	config.ReadSize, err = parseSize(config.ReadSizeStr)
+	if err != nil || config.ReadSize <= 0 {
+		return fmt.Errorf("invalid read size %s", config.ReadSizeStr)
+	}
+
+	if config.ReadCount <= 0 {
+		return fmt.Errorf("read count should be at least 1")
+	}
+
+	if !config.Read {
+		return nil
+	}
+
+	if config.Delete || config.SetTier || config.Verify || config.MixStr != "" || config.CreateStub || config.DeleteStub {
+		return fmt.Errorf("read can not be used along with delete, set-tier, verify, mix or stub modes")
+	}
+
+	if config.ManifestOutPath != "" {
+		return fmt.Errorf("manifest-out can not be used with read")
+	}
+
+	return nil
+}
+
+// getReadBytes : bytes read from a file of given size as per the read pattern
+func getReadBytes(size int64) int64 {
+	if config.ReadPattern == EReadPattern.RANDOM() && config.ReadSize < size {
+		return int64(config.ReadCount) * config.ReadSize
+	}
+	return size
+}
+
+// readFile : read the file of given size as per --read-pattern, each range is a separate storage call
+func readFile(ctx context.Context, rng *rand.Rand, name string, size int64) error {
+	read := func(offset int64, count int64) error {
+		opCtx, cancel := withOpTimeout(ctx)
+		defer cancel()
+
+		_, err := kalpavriksha.storage.DownloadData(opCtx, name, offset, count)
+		return err
+	}
+
+	if config.ReadPattern == EReadPattern.FULL() || size <= config.ReadSize {
+		// Count of 0 reads till the end of the file
+		return read(0, 0)
+	}
+
+	if config.ReadPattern == EReadPattern.SEQUENTIAL() {
+		for offset := int64(0); offset < size; offset += config.ReadSize {
+			count := config.ReadSize
+			if offset+count > size {
+				count = size - offset
+			}
+
+			err := read(offset, count)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i := 0; i < config.ReadCount; i++ {
+		err := read(rng.Int63n(size-config.ReadSize+1), config.ReadSize)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getJobFileSize : size of the file as recorded in the manifest the job came from, else as per the data source
+func getJobFileSize(job *workItem) int64 {
+	if job.expected != nil {
+		return job.expected.Size
+	}
+	return kalpavriksha.dataSrc.GetSize(job.path)
+}
+
+// newReadRandom : random stream of a worker for offsets of random reads
+func newReadRandom(w int) *rand.Rand {
+	return rand.New(rand.NewSource(int64(splitmix64(uint64(config.Seed) ^ readOffsetSalt + uint64(w)))))
+}
+
+// Workers for read task
+func readWorker(ctx context.Context, w int) {
+	defer kalpavriksha.wgWorkers.Done()
+	sched := newWorkerSchedule()
+	rng := newReadRandom(w)
+
+	for job := range kalpavriksha.jobs {
+		if isWindowOver() {
+			continue
+		}
+
+		jobCtx, ok := startJob(ctx, sched, &job)
+		if !ok {
+			continue
+		}
+
+		log.Printf("(%d) %s\n", w, job.path)
+		job.workerId = w
+		atomic.AddInt64(&WaitCount, -1)
+
+		job.status = EJobStatusType.INPROGRESS()
+
+		err := readFile(jobCtx, rng, job.path, getJobFileSize(&job))
+		if err != nil {
+			log.Printf("(%d) Failed to read %s (%s)\n", w, job.path, err.Error())
+			job.status = EJobStatusType.FAILED()
+		} else {
+			job.status = EJobStatusType.SUCCESS()
+		}
+
+		atomic.AddInt64(&WaitCount, 1)
+		kalpavriksha.results <- job
+	}
+}
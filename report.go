@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runReport : machine readable summary of a run, written with --report
+type runReport struct {
+	Task        string            `json:"task"`
+	Config      map[string]string `json:"config"`
+	Seed        int64             `json:"seed"` // Seed actually used, also when --seed was not given
+	Start       time.Time         `json:"start"`
+	End         time.Time         `json:"end"`
+	DurationSec float64           `json:"durationSec"`
+	Result      string            `json:"result"` // completed, failed or stopped
+	StopReason  string            `json:"stopReason,omitempty"`
+	Items       itemReport        `json:"items"`
+	Bytes       bytesReport       `json:"bytes"`
+	Errors      []errorReport     `json:"errors"`
+	Operations  []opReport        `json:"operations"`
+	Verify      *verifyReport     `json:"verify,omitempty"`
+}
+
+type itemReport struct {
+	Total        int64            `json:"total"`
+	ByStatus     map[string]int64 `json:"byStatus"`
+	NotProcessed int64            `json:"notProcessed"` // Items skipped as run was stopped
+}
+
+type bytesReport struct {
+	Uploaded   int64 `json:"uploaded"`
+	Downloaded int64 `json:"downloaded"`
+}
+
+type errorReport struct {
+	Op    string `json:"op"`
+	Code  string `json:"code"`
+	Count int64  `json:"count"`
+}
+
+// opReport : stats of one operation in one size bucket, size "all" covers every bucket
+type opReport struct {
+	Op        string        `json:"op"`
+	Size      string        `json:"size"`
+	Count     uint64        `json:"count"`
+	Errors    int64         `json:"errors"`
+	Bytes     int64         `json:"bytes"`
+	OpsPerSec float64       `json:"opsPerSec"`
+	MBPerSec  float64       `json:"mbPerSec"`
+	LatencyUs latencyReport `json:"latencyUs"`
+}
+
+type latencyReport struct {
+	Min  uint64  `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  uint64  `json:"p50"`
+	P90  uint64  `json:"p90"`
+	P99  uint64  `json:"p99"`
+	P999 uint64  `json:"p99.9"`
+	Max  uint64  `json:"max"`
+}
+
+type verifyReport struct {
+	Verified        int64 `json:"verified"`
+	Missing         int64 `json:"missing"`
+	SizeMismatch    int64 `json:"sizeMismatch"`
+	MD5Mismatch     int64 `json:"md5Mismatch"`
+	ContentMismatch int64 `json:"contentMismatch"`
+	Failed          int64 `json:"failed"`
+	Extra           int64 `json:"extra"`
+}
+
+// getReportTask : task performed by this run, including the ones which can not be journaled
+func getReportTask() string {
+	if config.Verify {
+		return "verify"
+	} else if config.CreateStub {
+		return "create-stub"
+	} else if config.DeleteStub {
+		return "delete-stub"
+	} else if config.Read {
+		return "read"
+	} else if config.Stat {
+		return "stat"
+	} else if config.MixStr != "" {
+		return "mix"
+	}
+	return getTaskName()
+}
+
+// getReportConfig : value of every flag, secrets in a connection string or SAS in endpoint are left out
+func getReportConfig() map[string]string {
+	values := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if f.Name == "endpoint" {
+			if isConnectionString(value) {
+				value = "<connection string>"
+			} else if idx := strings.Index(value, "?"); idx >= 0 {
+				value = value[:idx]
+			}
+		}
+		values[f.Name] = value
+	})
+	return values
+}
+
+func newLatencyReport(h *histogram) latencyReport {
+	l := latencyReport{
+		Min:  h.min,
+		P50:  h.percentile(50),
+		P90:  h.percentile(90),
+		P99:  h.percentile(99),
+		P999: h.percentile(99.9),
+		Max:  h.max,
+	}
+	if h.count > 0 {
+		l.Mean = float64(h.sum) / float64(h.count)
+	}
+	return l
+}
+
+func newOpReport(op OpType, size string, s *opStats, elapsed time.Duration) opReport {
+	r := opReport{
+		Op:        getOpName(op),
+		Size:      size,
+		Count:     s.latency.count,
+		Errors:    s.errors,
+		Bytes:     s.bytes,
+		LatencyUs: newLatencyReport(s.latency),
+	}
+	if secs := elapsed.Seconds(); secs > 0 {
+		r.OpsPerSec = float64(s.latency.count) / secs
+		r.MBPerSec = float64(s.bytes) / (1024 * 1024) / secs
+	}
+	return r
+}
+
+// addStats : operations, bytes and errors from the stats collector
+func (r *runReport) addStats(sc *statsCollector) {
+	sc.Lock()
+	defer sc.Unlock()
+
+	elapsed := r.End.Sub(sc.start)
+	ops := summarize(sc.total)
+
+	r.Operations = []opReport{}
+	for _, op := range getOpTypes(sc.total) {
+		for bucket := 0; bucket <= len(sizeBucketLimits); bucket++ {
+			if s, ok := sc.total[statsKey{op: op, bucket: bucket}]; ok {
+				r.Operations = append(r.Operations, newOpReport(op, getSizeBucketName(bucket), s, elapsed))
+			}
+		}
+		r.Operations = append(r.Operations, newOpReport(op, "all", ops[op], elapsed))
+	}
+
+	if s, ok := ops[EOpType.UPLOAD()]; ok {
+		r.Bytes.Uploaded = s.bytes
+	}
+	if s, ok := ops[EOpType.DOWNLOAD()]; ok {
+		r.Bytes.Downloaded = s.bytes
+	}
+
+	r.Errors = []errorReport{}
+	for key, count := range sc.errors {
+		r.Errors = append(r.Errors, errorReport{Op: getOpName(key.op), Code: key.code, Count: count})
+	}
+	sort.Slice(r.Errors, func(i, j int) bool {
+		if r.Errors[i].Op != r.Errors[j].Op {
+			return r.Errors[i].Op < r.Errors[j].Op
+		}
+		return r.Errors[i].Code < r.Errors[j].Code
+	})
+}
+
+// newRunReport : report of the run which started at given time, reason is set when it was stopped
+func newRunReport(start time.Time, reason string, failed bool) *runReport {
+	r := &runReport{
+		Task:       getReportTask(),
+		Config:     getReportConfig(),
+		Seed:       config.Seed,
+		Start:      start.UTC(),
+		End:        time.Now().UTC(),
+		Result:     "completed",
+		StopReason: reason,
+	}
+	r.DurationSec = r.End.Sub(r.Start).Seconds()
+
+	if reason != "" {
+		r.Result = "stopped"
+	} else if failed || kalpavriksha.itemCounts[EJobStatusType.FAILED()] > 0 {
+		r.Result = "failed"
+	}
+
+	r.Items = itemReport{Total: kalpavriksha.itemsTotal, ByStatus: make(map[string]int64)}
+	processed := int64(0)
+	for status, count := range kalpavriksha.itemCounts {
+		r.Items.ByStatus[status.String()] = count
+		processed += count
+	}
+	if r.Items.Total > processed {
+		r.Items.NotProcessed = r.Items.Total - processed
+	}
+
+	r.addStats(kalpavriksha.stats)
+
+	if config.Verify {
+		r.Verify = &verifyReport{
+			Verified:        verifyResult.verified,
+			Missing:         verifyResult.missing,
+			SizeMismatch:    verifyResult.sizeMismatch,
+			MD5Mismatch:     verifyResult.md5Mismatch,
+			ContentMismatch: verifyResult.contentMismatch,
+			Failed:          verifyResult.failed,
+			Extra:           verifyResult.extra,
+		}
+	}
+
+	return r
+}
+
+// writeReport : write the report as JSON to given file, "-" writes it to stdout
+func writeReport(r *runReport, path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0666)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// newRunContext : contexts controlling how long the run goes on
+// ctx is parent of every storage call, it is cancelled on run timeout or second interrupt and aborts work in flight.
+// stop is cancelled on first interrupt or run timeout, after which no new work is picked and work in flight drains.
+func newRunContext() (ctx context.Context, stop context.Context, cleanup func()) {
+	ctx, abort := context.WithCancel(context.Background())
+
+	cancelTimeout := func() {}
+	if config.RunTimeout > 0 {
+		ctx, cancelTimeout = context.WithTimeout(ctx, config.RunTimeout)
+	}
+
+	stop, cancelStop := context.WithCancel(ctx)
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		for count := 1; ; count++ {
+			select {
+			case sig := <-signals:
+				if count == 1 {
+					log.Printf("Received %s, waiting for work in flight to finish\n", sig)
+					fmt.Printf("Received %s, waiting for work in flight to finish, interrupt again to abort it\n", sig)
+					cancelStop()
+				} else {
+					log.Printf("Received %s again, aborting work in flight\n", sig)
+					fmt.Printf("Received %s again, aborting work in flight\n", sig)
+					abort()
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	cleanup = func() {
+		signal.Stop(signals)
+		cancelStop()
+		cancelTimeout()
+		abort()
+	}
+
+	return ctx, stop, cleanup
+}
+
+// getStopReason : why the run stopped before all of its work was done, empty if it was not stopped
+func getStopReason(ctx context.Context, stop context.Context) string {
+	if stop.Err() == nil {
+		return ""
+	} else if ctx.Err() == context.DeadlineExceeded {
+		return "run timeout"
+	}
+	return "interrupted"
+}
+
+// isStopped : run has been asked to stop so no new work should be picked
+func isStopped() bool {
+	return kalpavriksha.stop.Err() != nil
+}
+
+// withOpTimeout : context for a single storage call, bounded by --op-timeout when given
+func withOpTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if config.OpTimeout > 0 {
+		return context.WithTimeout(ctx, config.OpTimeout)
+	}
+	return context.WithCancel(ctx)
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Mapping of blob tiers to S3 storage classes, any other value is passed as is to S3
+var s3StorageClass = map[string]string{
+	"hot":     "STANDARD",
+	"cool":    "STANDARD_IA",
+	"cold":    "GLACIER_IR",
+	"archive": "GLACIER",
+}
+
+// Maximum number of parts in a multipart upload
+const s3MaxParts = 10000
+
+// Minimum size of every part but the last one of a multipart upload, smaller ones fail with EntityTooSmall
+const s3MinPartSize = 5 * 1024 * 1024
+
+// Time allowed to abort a failed multipart upload, independent of the upload which may have been cancelled
+const s3AbortTimeout = 30 * time.Second
+
+// SHA256 of empty payload, zero byte objects are signed with it as streaming signature sends them chunked
+const s3EmptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Storage : S3 compatible object store like AWS S3, MinIO or Ceph RGW
+type S3Storage struct {
+	StorageConfig
+	S3Client *minio.Core // Client to hold S3 connection
+}
+
+func (ss *S3Storage) Init() error {
+	if ss.S3Endpoint == "" || ss.S3Bucket == "" {
+		return fmt.Errorf("s3 endpoint and bucket are required")
+	}
+
+	// Endpoint can be given as a URL or as host:port, URL decides whether TLS is used or not
+	endpoint := ss.S3Endpoint
+	secure := true
+	if strings.Contains(endpoint, "://") {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return err
+		}
+		endpoint = u.Host
+		secure = u.Scheme == "https"
+	}
+
+	var err error
+	ss.S3Client, err = minio.NewCore(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(ss.S3AccessKey, ss.S3SecretKey, ss.S3SessionToken),
+		Secure: secure,
+		Region: ss.S3Region,
+	})
+
+	return err
+}
+
+func (ss *S3Storage) TestConnection(ctx context.Context) error {
+	exists, err := ss.S3Client.BucketExists(ctx, ss.S3Bucket)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("bucket %s does not exists", ss.S3Bucket)
+	}
+
+	// Try to list the bucket and see if auth gets validated or not
+	_, err = ss.S3Client.ListObjectsV2(ss.S3Bucket, "", "", "", "/", 2)
+	return err
+}
+
+func (ss *S3Storage) getStorageClass(tier blob.AccessTier) string {
+	class, ok := s3StorageClass[strings.ToLower(string(tier))]
+	if !ok {
+		class = strings.ToUpper(string(tier))
+	}
+	return class
+}
+
+func (ss *S3Storage) UploadData(ctx context.Context, name string, data []byte, o *UploadOptions) error {
+	opts := minio.PutObjectOptions{}
+	md5Sum := ""
+
+	if o != nil {
+		if o.MD5Sum != nil {
+			md5Sum = base64.StdEncoding.EncodeToString(o.MD5Sum)
+		}
+
+		if o.Tier != nil {
+			opts.StorageClass = ss.getStorageClass(*o.Tier)
+		}
+	}
+
+	sha256Sum := ""
+	if len(data) == 0 {
+		sha256Sum = s3EmptySHA256
+		opts.DisableContentSha256 = true
+	}
+
+	_, err := ss.S3Client.PutObject(ctx, ss.S3Bucket, filepath.ToSlash(filepath.Join(ss.DestinationPath, name)),
+		bytes.NewReader(data), int64(len(data)), md5Sum, sha256Sum, opts)
+
+	return err
+}
+
+// getS3PartSize : part size for an object of given size, block size raised to what S3 accepts
+// Parts are at least 5 MiB and large enough that the object fits in 10000 parts, 0 means no multipart upload
+func getS3PartSize(blockSize int64, size int64) int64 {
+	if blockSize <= 0 {
+		return 0
+	}
+
+	partSize := blockSize
+	if partSize < s3MinPartSize {
+		partSize = s3MinPartSize
+	}
+
+	if minSize := (size + s3MaxParts - 1) / s3MaxParts; partSize < minSize {
+		// Rounded up to MiB so that parts stay aligned
+		partSize = (minSize + 1024*1024 - 1) / (1024 * 1024) * (1024 * 1024)
+	}
+	return partSize
+}
+
+// UploadStream : upload each block as a part of multipart upload, smaller objects are uploaded in one go
+func (ss *S3Storage) UploadStream(ctx context.Context, name string, r io.ReaderAt, size int64, o *UploadOptions) error {
+	partSize := getS3PartSize(ss.BlockSize, size)
+	if partSize <= 0 || size <= partSize {
+		data := make([]byte, size)
+		n, err := r.ReadAt(data, 0)
+		if int64(n) < size {
+			if err == nil {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		return ss.UploadData(ctx, name, data, o)
+	}
+
+	partCount := (size + partSize - 1) / partSize
+
+	key := filepath.ToSlash(filepath.Join(ss.DestinationPath, name))
+	opts := minio.PutObjectOptions{}
+	if o != nil && o.Tier != nil {
+		opts.StorageClass = ss.getStorageClass(*o.Tier)
+	}
+
+	uploadID, err := ss.S3Client.NewMultipartUpload(ctx, ss.S3Bucket, key, opts)
+	if err != nil {
+		return err
+	}
+
+	// Whole object MD5 can not be set on a multipart upload so MD5 of each part is sent instead
+	parts := make([]minio.CompletePart, 0, partCount)
+	err = forEachBlock(r, size, partSize, func(offset int64, data []byte) error {
+		md5Sum := ""
+		if o != nil && o.MD5Sum != nil {
+			md5Sum = base64.StdEncoding.EncodeToString(getMD5Sum(data))
+		}
+
+		part, err := ss.S3Client.PutObjectPart(ctx, ss.S3Bucket, key, uploadID, len(parts)+1,
+			bytes.NewReader(data), int64(len(data)), md5Sum, "", nil)
+		if err != nil {
+			return err
+		}
+
+		parts = append(parts, minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag})
+		return nil
+	})
+
+	if err == nil {
+		_, err = ss.S3Client.CompleteMultipartUpload(ctx, ss.S3Bucket, key, uploadID, parts, opts)
+	}
+
+	if err != nil {
+		// Do not leave the parts uploaded so far lying around in the bucket, even when upload was cancelled
+		abortCtx, cancel := context.WithTimeout(context.Background(), s3AbortTimeout)
+		defer cancel()
+
+		abortErr := ss.S3Client.AbortMultipartUpload(abortCtx, ss.S3Bucket, key, uploadID)
+		if abortErr != nil {
+			log.Printf("Failed to abort multipart upload of %s (%s)\n", key, abortErr.Error())
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (ss *S3Storage) DownloadData(ctx context.Context, name string, offset int64, count int64) ([]byte, error) {
+	key := filepath.ToSlash(filepath.Join(ss.DestinationPath, name))
+
+	opts := minio.GetObjectOptions{}
+	err := setS3Range(&opts, offset, count)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, _, _, err := ss.S3Client.GetObject(ctx, ss.S3Bucket, key, opts)
+	if err != nil {
+		return nil, ss.convertError(err, http.MethodGet, key)
+	}
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
+
+// setS3Range : ask for count bytes from offset, or everything from offset when count is 0
+func setS3Range(opts *minio.GetObjectOptions, offset int64, count int64) error {
+	if count > 0 {
+		return opts.SetRange(offset, offset+count-1)
+	} else if offset > 0 {
+		return opts.SetRange(offset, 0)
+	}
+	return nil
+}
+
+// convertError : report missing object the same way as storage service so that callers can check for it
+func (ss *S3Storage) convertError(err error, method string, key string) error {
+	if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+		return newStorageError(method, key, http.StatusNotFound, bloberror.BlobNotFound)
+	}
+	return err
+}
+
+func (ss *S3Storage) Delete(ctx context.Context, name string, o *DeleteOptions) error {
+	key := filepath.ToSlash(filepath.Join(ss.DestinationPath, name))
+	if o != nil && o.IsStub {
+		key += "/"
+	}
+
+	return ss.S3Client.RemoveObject(ctx, ss.S3Bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (ss *S3Storage) SetTier(ctx context.Context, name string, tier blob.AccessTier) error {
+	// S3 changes the storage class by copying object on to itself
+	key := filepath.ToSlash(filepath.Join(ss.DestinationPath, name))
+	_, err := ss.S3Client.CopyObject(ctx, ss.S3Bucket, key, ss.S3Bucket, key,
+		map[string]string{
+			"x-amz-storage-class":      ss.getStorageClass(tier),
+			"x-amz-metadata-directive": "COPY",
+		},
+		minio.CopySrcOptions{}, minio.PutObjectOptions{})
+
+	return err
+}
+
+func (ss *S3Storage) CreateStub(ctx context.Context, name string) error {
+	// Directory stub in S3 is a zero byte object with trailing '/'
+	key := filepath.ToSlash(filepath.Join(ss.DestinationPath, name)) + "/"
+
+	_, err := ss.S3Client.StatObject(ctx, ss.S3Bucket, key, minio.StatObjectOptions{})
+	if err == nil {
+		return newStorageError(http.MethodPut, key, http.StatusConflict, bloberror.BlobAlreadyExists)
+	}
+
+	_, err = ss.S3Client.PutObject(ctx, ss.S3Bucket, key, bytes.NewReader(nil), 0, "", s3EmptySHA256, minio.PutObjectOptions{DisableContentSha256: true})
+	return err
+}
+
+func (ss *S3Storage) ListBlobs(name string) *runtime.Pager[container.ListBlobsHierarchyResponse] {
+	listPath := ss.DestinationPath
+	if listPath != "" {
+		listPath += "/"
+	}
+	listPath += name
+
+	return runtime.NewPager(runtime.PagingHandler[container.ListBlobsHierarchyResponse]{
+		More: func(page container.ListBlobsHierarchyResponse) bool {
+			return page.NextMarker != nil && *page.NextMarker != ""
+		},
+		Fetcher: func(ctx context.Context, page *container.ListBlobsHierarchyResponse) (container.ListBlobsHierarchyResponse, error) {
+			marker := ""
+			if page != nil && page.NextMarker != nil {
+				marker = *page.NextMarker
+			}
+
+			result, err := ss.S3Client.ListObjectsV2(ss.S3Bucket, listPath, "", marker, "/", listMaxResults)
+			if err != nil {
+				return container.ListBlobsHierarchyResponse{}, err
+			}
+
+			resp := container.ListBlobsHierarchyResponse{}
+			resp.Prefix = to.Ptr(listPath)
+			resp.Delimiter = to.Ptr("/")
+			resp.Marker = to.Ptr(marker)
+			resp.Segment = &container.BlobHierarchyListSegment{}
+
+			for _, prefix := range result.CommonPrefixes {
+				resp.Segment.BlobPrefixes = append(resp.Segment.BlobPrefixes, &container.BlobPrefix{Name: to.Ptr(prefix.Prefix)})
+			}
+
+			for _, item := range result.Contents {
+				// Directory marker object of the path being listed is not a child of it
+				if item.Key == listPath && strings.HasSuffix(item.Key, "/") {
+					continue
+				}
+
+				resp.Segment.BlobItems = append(resp.Segment.BlobItems, &container.BlobItem{
+					Name: to.Ptr(item.Key),
+					Properties: &container.BlobProperties{
+						ContentLength: to.Ptr(item.Size),
+						ContentMD5:    s3ETagToMD5(item.ETag),
+						AccessTier:    to.Ptr(blob.AccessTier(item.StorageClass)),
+						LastModified:  to.Ptr(item.LastModified),
+						ETag:          to.Ptr(azcore.ETag(item.ETag)),
+					},
+				})
+			}
+
+			if result.IsTruncated {
+				resp.NextMarker = to.Ptr(result.NextContinuationToken)
+			}
+
+			return resp, nil
+		},
+	})
+}
+
+func (ss *S3Storage) GetProperties(ctx context.Context, name string) (blob.GetPropertiesResponse, error) {
+	key := filepath.ToSlash(filepath.Join(ss.DestinationPath, name))
+	info, err := ss.S3Client.StatObject(ctx, ss.S3Bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return blob.GetPropertiesResponse{}, ss.convertError(err, http.MethodHead, key)
+	}
+
+	resp := blob.GetPropertiesResponse{
+		ContentLength: to.Ptr(info.Size),
+		ContentMD5:    s3ETagToMD5(info.ETag),
+		LastModified:  to.Ptr(info.LastModified),
+		ETag:          to.Ptr(azcore.ETag(info.ETag)),
+		Metadata:      make(map[string]*string),
+	}
+
+	if info.StorageClass != "" {
+		resp.AccessTier = to.Ptr(info.StorageClass)
+	}
+
+	for k, v := range info.UserMetadata {
+		resp.Metadata[k] = to.Ptr(v)
+	}
+
+	return resp, nil
+}
+
+// s3ETagToMD5 : ETag of an object uploaded in single part is hex encoded MD5 Sum of its content
+func s3ETagToMD5(etag string) []byte {
+	etag = strings.Trim(etag, "\"")
+	if len(etag) != 32 {
+		// Multipart uploads have etag of form md5-N which is not MD5 Sum of the content
+		return nil
+	}
+
+	md5sum, err := hex.DecodeString(etag)
+	if err != nil {
+		return nil
+	}
+	return md5sum
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestGetS3PartSize(t *testing.T) {
+	const mb = 1024 * 1024
+
+	if getS3PartSize(0, 100*mb) != 0 {
+		t.Errorf("no block size should mean no multipart upload")
+	}
+
+	// Parts below 5 MiB are rejected by S3 so small block sizes are raised
+	if size := getS3PartSize(1*mb, 100*mb); size != s3MinPartSize {
+		t.Errorf("1 MiB block gave part size %d", size)
+	}
+	if size := getS3PartSize(8*mb, 100*mb); size != 8*mb {
+		t.Errorf("8 MiB block gave part size %d", size)
+	}
+
+	// Objects needing more than 10000 parts get larger parts, rounded to MiB
+	if size := getS3PartSize(8*mb, 80000*mb); size != 8*mb {
+		t.Errorf("object of exactly 10000 parts gave part size %d", size)
+	}
+	if size := getS3PartSize(8*mb, 80000*mb+1); size != 9*mb {
+		t.Errorf("object just over 10000 parts gave part size %d", size)
+	}
+
+	size := getS3PartSize(5*mb, 1<<40)
+	if (1<<40+size-1)/size > s3MaxParts {
+		t.Errorf("1 TiB object needs more than %d parts of %d", s3MaxParts, size)
+	}
+}
+
+func TestSetS3Range(t *testing.T) {
+	getRange := func(offset int64, count int64) string {
+		opts := minio.GetObjectOptions{}
+		if err := setS3Range(&opts, offset, count); err != nil {
+			t.Fatalf("range %d+%d : %v", offset, count, err)
+		}
+		return opts.Header().Get("Range")
+	}
+
+	if r := getRange(0, 0); r != "" {
+		t.Errorf("whole object asked for range %q", r)
+	}
+
+	// First byte alone is a range ending at 0, which is not the same as no range
+	if r := getRange(0, 1); r != "bytes=0-0" {
+		t.Errorf("first byte asked for range %q", r)
+	}
+	if r := getRange(10, 5); r != "bytes=10-14" {
+		t.Errorf("5 bytes from 10 asked for range %q", r)
+	}
+	if r := getRange(10, 0); r != "bytes=10-" {
+		t.Errorf("everything from 10 asked for range %q", r)
+	}
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Salt mixed in the key of a file so that its size does not correlate with the first word of its data
+const sizeSalt uint64 = 0x5eed5eed5eed5eed
+
+// Largest size drawn by heavy tailed distributions when no max is given, their tail otherwise reaches
+// sizes which can not be held in memory for upload
+const defaultSizeDistMax int64 = 4 << 30
+
+// -------------------------------------------------------------------
+// sizeDistribution : decides size of each file from a uniform random number
+// Every distribution maps u in [0, 1) to a size using its inverse CDF so one random number per file is enough
+type sizeDistribution interface {
+	Size(u float64) int64
+	String() string
+}
+
+// getFileSize : size of the given file, same for a given seed and name across runs
+func getFileSize(dist sizeDistribution, seed int64, name string) int64 {
+	// Top 53 bits give a uniformly distributed float64 in [0, 1)
+	u := float64(splitmix64(seededKey(seed, name)^sizeSalt)>>11) / (1 << 53)
+	return dist.Size(u)
+}
+
+// clampSize : keep size within [min, max], max of 0 means no upper limit
+func clampSize(size float64, min int64, max int64) int64 {
+	if math.IsNaN(size) || size < float64(min) {
+		return min
+	}
+	if max > 0 && size > float64(max) {
+		return max
+	}
+	if size >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(size)
+}
+
+// -------------------------------------------------------------------
+// fixedSize : every file has same size
+type fixedSize struct {
+	size int64
+}
+
+func (d *fixedSize) Size(u float64) int64 {
+	return d.size
+}
+
+func (d *fixedSize) String() string {
+	return fmt.Sprintf("fixed:%s", formatSize(d.size))
+}
+
+// -------------------------------------------------------------------
+// uniformSize : size picked uniformly from [min, max]
+type uniformSize struct {
+	min int64
+	max int64
+}
+
+func (d *uniformSize) Size(u float64) int64 {
+	return clampSize(float64(d.min)+u*float64(d.max-d.min+1), d.min, d.max)
+}
+
+func (d *uniformSize) String() string {
+	return fmt.Sprintf("uniform:%s-%s", formatSize(d.min), formatSize(d.max))
+}
+
+// -------------------------------------------------------------------
+// logNormalSize : log of size is normally distributed, most files are around median with a long tail
+type logNormalSize struct {
+	mu    float64 // Mean of log of size, i.e. log of median size
+	sigma float64 // Standard deviation of log of size
+	min   int64
+	max   int64
+}
+
+func (d *logNormalSize) Size(u float64) int64 {
+	z := math.Sqrt2 * math.Erfinv(2*u-1)
+	return clampSize(math.Exp(d.mu+d.sigma*z), d.min, d.max)
+}
+
+func (d *logNormalSize) String() string {
+	return fmt.Sprintf("lognormal:median=%s,sigma=%g,min=%s,max=%s",
+		formatSize(int64(math.Round(math.Exp(d.mu)))), d.sigma, formatSize(d.min), formatSize(d.max))
+}
+
+// -------------------------------------------------------------------
+// paretoSize : heavy tailed distribution, lots of files close to min and a few very large ones
+type paretoSize struct {
+	min   int64   // Scale, smallest size generated
+	alpha float64 // Shape, smaller value gives a heavier tail
+	max   int64
+}
+
+func (d *paretoSize) Size(u float64) int64 {
+	return clampSize(float64(d.min)/math.Pow(1-u, 1/d.alpha), d.min, d.max)
+}
+
+func (d *paretoSize) String() string {
+	return fmt.Sprintf("pareto:min=%s,alpha=%g,max=%s", formatSize(d.min), d.alpha, formatSize(d.max))
+}
+
+// -------------------------------------------------------------------
+// bucketSize : bucket is picked as per its weight and size is picked uniformly within the bucket
+// Used for weighted buckets as well as empirical histogram loaded from a file
+type sizeBucket struct {
+	min    int64
+	max    int64
+	weight float64
+}
+
+type bucketSize struct {
+	name       string
+	buckets    []sizeBucket
+	cumulative []float64 // Cumulative weight upto and including each bucket
+}
+
+func newBucketSize(name string, buckets []sizeBucket) (*bucketSize, error) {
+	if len(buckets) == 0 {
+		return nil, fmt.Errorf("%s needs at least one bucket", name)
+	}
+
+	d := &bucketSize{name: name, buckets: buckets}
+	total := 0.0
+	for _, b := range buckets {
+		if b.weight < 0 || b.min > b.max {
+			return nil, fmt.Errorf("invalid bucket %s-%s=%g", formatSize(b.min), formatSize(b.max), b.weight)
+		}
+		total += b.weight
+		d.cumulative = append(d.cumulative, total)
+	}
+
+	if total <= 0 {
+		return nil, fmt.Errorf("%s needs a bucket with non zero weight", name)
+	}
+	return d, nil
+}
+
+func (d *bucketSize) Size(u float64) int64 {
+	total := d.cumulative[len(d.cumulative)-1]
+	target := u * total
+
+	idx := sort.Search(len(d.cumulative), func(i int) bool { return d.cumulative[i] > target })
+	if idx == len(d.buckets) {
+		idx--
+	}
+	b := d.buckets[idx]
+
+	// Position of target within the chosen bucket is again uniform in [0, 1)
+	low := d.cumulative[idx] - b.weight
+	v := (target - low) / b.weight
+	return clampSize(float64(b.min)+v*float64(b.max-b.min+1), b.min, b.max)
+}
+
+func (d *bucketSize) String() string {
+	parts := make([]string, 0, len(d.buckets))
+	for _, b := range d.buckets {
+		if b.min == b.max {
+			parts = append(parts, fmt.Sprintf("%s=%g", formatSize(b.min), b.weight))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s-%s=%g", formatSize(b.min), formatSize(b.max), b.weight))
+		}
+	}
+	return d.name + ":" + strings.Join(parts, ",")
+}
+
+// -------------------------------------------------------------------
+
+// parseSizeDistribution : parse distribution given as "<type>:<params>"
+//
+//	fixed:1MiB
+//	uniform:4KiB-16MiB
+//	lognormal:median=64KiB,sigma=1.5[,min=1KiB][,max=1GiB]
+//	pareto:min=4KiB,alpha=1.2[,max=100GiB]
+//	buckets:4KiB-64KiB=70,64KiB-1MiB=25,1GiB=5
+//	histogram:<csv file with min,max,weight or size,weight on each line>
+func parseSizeDistribution(s string) (sizeDistribution, error) {
+	kind, params, _ := strings.Cut(s, ":")
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	params = strings.TrimSpace(params)
+
+	switch kind {
+	case "fixed":
+		size, err := parseSize(params)
+		if err != nil {
+			return nil, err
+		}
+		return &fixedSize{size: size}, nil
+
+	case "uniform":
+		min, max, err := parseSizeRange(params)
+		if err != nil {
+			return nil, err
+		}
+		return &uniformSize{min: min, max: max}, nil
+
+	case "lognormal":
+		kv, err := parseDistParams(params, "median", "sigma", "min", "max")
+		if err != nil {
+			return nil, err
+		}
+
+		median, err := parseSize(kv["median"])
+		if err != nil || median <= 0 {
+			return nil, fmt.Errorf("lognormal needs a positive median")
+		}
+
+		sigma, err := strconv.ParseFloat(kv["sigma"], 64)
+		if err != nil || math.IsNaN(sigma) || math.IsInf(sigma, 0) || sigma < 0 {
+			return nil, fmt.Errorf("lognormal needs a non negative sigma")
+		}
+
+		d := &logNormalSize{mu: math.Log(float64(median)), sigma: sigma}
+		if d.min, d.max, err = parseSizeLimits(kv, defaultSizeDistMax); err != nil {
+			return nil, err
+		}
+		return d, nil
+
+	case "pareto":
+		kv, err := parseDistParams(params, "min", "alpha", "max")
+		if err != nil {
+			return nil, err
+		}
+
+		d := &paretoSize{}
+		if d.min, d.max, err = parseSizeLimits(kv, defaultSizeDistMax); err != nil {
+			return nil, err
+		}
+		if d.min <= 0 {
+			return nil, fmt.Errorf("pareto needs a positive min")
+		}
+
+		d.alpha, err = strconv.ParseFloat(kv["alpha"], 64)
+		if err != nil || math.IsNaN(d.alpha) || math.IsInf(d.alpha, 0) || d.alpha <= 0 {
+			return nil, fmt.Errorf("pareto needs a positive alpha")
+		}
+		return d, nil
+
+	case "buckets":
+		buckets := make([]sizeBucket, 0)
+		for _, part := range strings.Split(params, ",") {
+			sizeRange, weight, ok := strings.Cut(part, "=")
+			if !ok {
+				return nil, fmt.Errorf("bucket %s is not of form <min>-<max>=<weight>", part)
+			}
+
+			b, err := parseSizeBucket(sizeRange, weight)
+			if err != nil {
+				return nil, err
+			}
+			buckets = append(buckets, b)
+		}
+		return newBucketSize("buckets", buckets)
+
+	case "histogram":
+		return loadSizeHistogram(params)
+	}
+
+	return nil, fmt.Errorf("invalid size distribution %s", s)
+}
+
+// loadSizeHistogram : read empirical size histogram from a csv file
+// Each line is either "min,max,weight" or "size,weight", lines starting with '#' are ignored
+func loadSizeHistogram(path string) (sizeDistribution, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	buckets := make([]sizeBucket, 0)
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		var b sizeBucket
+		switch len(record) {
+		case 2:
+			b, err = parseSizeBucket(record[0], record[1])
+		case 3:
+			b, err = parseSizeBucket(record[0]+"-"+record[1], record[2])
+		default:
+			err = fmt.Errorf("expected 2 or 3 fields found %d", len(record))
+		}
+
+		if err != nil {
+			if line == 1 {
+				// First line can be a header
+				continue
+			}
+			return nil, fmt.Errorf("%s line %d : %s", path, line, err.Error())
+		}
+		buckets = append(buckets, b)
+	}
+
+	return newBucketSize("histogram", buckets)
+}
+
+// parseDistParams : parse "key=value,key=value" and make sure only known keys are present
+func parseDistParams(s string, keys ...string) (map[string]string, error) {
+	kv := make(map[string]string)
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+
+		k, v, ok := strings.Cut(part, "=")
+		k = strings.ToLower(strings.TrimSpace(k))
+		if !ok || k == "" {
+			return nil, fmt.Errorf("parameter %s is not of form <key>=<value>", part)
+		}
+		kv[k] = strings.TrimSpace(v)
+	}
+
+	for k := range kv {
+		known := false
+		for _, key := range keys {
+			known = known || k == key
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown parameter %s, expected one of %s", k, strings.Join(keys, " / "))
+		}
+	}
+
+	return kv, nil
+}
+
+// parseSizeLimits : optional min and max parameters of a distribution, max is defaultMax when not given
+func parseSizeLimits(kv map[string]string, defaultMax int64) (int64, int64, error) {
+	min, max := int64(0), defaultMax
+	var err error
+
+	if kv["min"] != "" {
+		if min, err = parseSize(kv["min"]); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if kv["max"] != "" {
+		if max, err = parseSize(kv["max"]); err != nil {
+			return 0, 0, err
+		}
+	} else if max < min {
+		return 0, 0, fmt.Errorf("min %s is more than default max %s, give max as well", kv["min"], formatSize(max))
+	}
+
+	if max < min {
+		return 0, 0, fmt.Errorf("max %s is less than min %s", kv["max"], kv["min"])
+	}
+	return min, max, nil
+}
+
+// parseSizeBucket : bucket given as range (or single size) and its weight
+func parseSizeBucket(sizeRange string, weight string) (sizeBucket, error) {
+	min, max, err := parseSizeRange(sizeRange)
+	if err != nil {
+		return sizeBucket{}, err
+	}
+
+	w, err := strconv.ParseFloat(strings.TrimSpace(weight), 64)
+	if err != nil || math.IsNaN(w) || math.IsInf(w, 0) || w < 0 {
+		return sizeBucket{}, fmt.Errorf("invalid weight %s", weight)
+	}
+
+	return sizeBucket{min: min, max: max, weight: w}, nil
+}
+
+// parseSizeRange : parse "<min>-<max>", a single size means min and max are same
+func parseSizeRange(s string) (int64, int64, error) {
+	minStr, maxStr, isRange := strings.Cut(s, "-")
+
+	min, err := parseSize(minStr)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if !isRange {
+		return min, min, nil
+	}
+
+	max, err := parseSize(maxStr)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if max < min {
+		return 0, 0, fmt.Errorf("invalid size range %s", s)
+	}
+	return min, max, nil
+}
+
+// Size units, KB / MB / GB / TB are decimal and the rest are binary
+var sizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"kib", 1 << 10}, {"mib", 1 << 20}, {"gib", 1 << 30}, {"tib", 1 << 40},
+	{"kb", 1000}, {"mb", 1000 * 1000}, {"gb", 1000 * 1000 * 1000}, {"tb", 1000 * 1000 * 1000 * 1000},
+	{"k", 1 << 10}, {"m", 1 << 20}, {"g", 1 << 30}, {"t", 1 << 40},
+	{"b", 1},
+}
+
+// parseSize : parse size like "512", "4KiB", "1.5MiB" or "10GB" in to bytes
+func parseSize(s string) (int64, error) {
+	str := strings.ToLower(strings.TrimSpace(s))
+	multiplier := int64(1)
+
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(str, unit.suffix) {
+			str = strings.TrimSpace(strings.TrimSuffix(str, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	// ParseFloat accepts nan and inf as well, those never make a size
+	val, err := strconv.ParseFloat(str, 64)
+	if err != nil || math.IsNaN(val) || math.IsInf(val, 0) || val < 0 || val*float64(multiplier) >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size %s", s)
+	}
+
+	return int64(val * float64(multiplier)), nil
+}
+
+// formatSize : print size with largest binary unit which represents it exactly
+func formatSize(size int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for i < len(units)-1 && size != 0 && size%1024 == 0 {
+		size /= 1024
+		i++
+	}
+	return fmt.Sprintf("%d%s", size, units[i])
+}
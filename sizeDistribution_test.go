@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	sizes := map[string]int64{
+		"0":        0,
+		"512":      512,
+		"512b":     512,
+		"4k":       4 << 10,
+		"4KiB":     4 << 10,
+		" 1.5MiB ": 3 << 19,
+		"2GiB":     2 << 30,
+		"1TiB":     1 << 40,
+		"10KB":     10 * 1000,
+		"10GB":     10 * 1000 * 1000 * 1000,
+	}
+	for s, want := range sizes {
+		if size, err := parseSize(s); err != nil || size != want {
+			t.Errorf("%q gave %d (%v), expected %d", s, size, err, want)
+		}
+	}
+
+	for _, s := range []string{"", "abc", "KiB", "-1", "-1KiB", "nan", "NaN", "inf", "+Inf", "1e30TiB"} {
+		if size, err := parseSize(s); err == nil {
+			t.Errorf("%q should be rejected, gave %d", s, size)
+		}
+	}
+}
+
+// Sizes drawn from a distribution stay within its limits over the whole range of u
+func checkSizes(t *testing.T, spec string, min int64, max int64) {
+	dist, err := parseSizeDistribution(spec)
+	if err != nil {
+		t.Fatalf("%s: %v", spec, err)
+	}
+
+	for _, u := range []float64{0, 0.001, 0.5, 0.999, 1 - 1.0/(1<<53)} {
+		if size := dist.Size(u); size < min || size > max {
+			t.Errorf("%s: size %d for u=%g outside [%d, %d]", spec, size, u, min, max)
+		}
+	}
+}
+
+func TestParseSizeDistribution(t *testing.T) {
+	checkSizes(t, "fixed:1MiB", 1<<20, 1<<20)
+	checkSizes(t, "uniform:4KiB-64KiB", 4<<10, 64<<10)
+	checkSizes(t, "lognormal:median=256KiB,sigma=1.5,min=1KiB,max=16MiB", 1<<10, 16<<20)
+	checkSizes(t, "pareto:min=4KiB,alpha=1.2,max=1GiB", 4<<10, 1<<30)
+	checkSizes(t, "buckets:4KiB-64KiB=70,64KiB-1MiB=25,1GiB=5", 4<<10, 1<<30)
+
+	// Heavy tails without max stop at the default one instead of sizes which can not be allocated
+	checkSizes(t, "lognormal:median=1MiB,sigma=50", 0, defaultSizeDistMax)
+	checkSizes(t, "pareto:min=4KiB,alpha=0.01", 4<<10, defaultSizeDistMax)
+	checkSizes(t, "lognormal:median=1MiB,sigma=50,max=1TiB", 0, 1<<40)
+
+	for _, spec := range []string{
+		"fixed:nan",
+		"fixed:-1",
+		"uniform:64KiB-4KiB",
+		"lognormal:median=0,sigma=1",
+		"lognormal:median=1MiB,sigma=nan",
+		"lognormal:median=1MiB,sigma=-1",
+		"pareto:min=4KiB,alpha=0",
+		"pareto:min=4KiB,alpha=nan",
+		"pareto:min=8GiB,alpha=1",
+		"buckets:1KiB=nan",
+		"buckets:1KiB=-1",
+		"unknown:1",
+	} {
+		if _, err := parseSizeDistribution(spec); err == nil {
+			t.Errorf("%s should be rejected", spec)
+		}
+	}
+}
+
+func TestGetFileSizeIsSeeded(t *testing.T) {
+	dist, err := parseSizeDistribution("uniform:0-1GiB")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size := getFileSize(dist, 42, "dir-0/file-1")
+	if getFileSize(dist, 42, "dir-0/file-1") != size {
+		t.Errorf("same seed and name gave different sizes")
+	}
+	if getFileSize(dist, 43, "dir-0/file-1") == size && getFileSize(dist, 44, "dir-0/file-1") == size {
+		t.Errorf("size does not depend on seed")
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"path"
+	"reflect"
+	"sort"
+	"sync/atomic"
+
+	"github.com/JeffreyRichter/enum/enum"
+)
+
+// Salts of the random streams used by stat workload
+const (
+	statTargetSalt uint64 = 0x5a5a5a5a5a5a5a5a
+	statListSalt   uint64 = 0x6b6b6b6b6b6b6b6b
+	statRankSalt   uint64 = 0x1e1e1e1e1e1e1e1e
+)
+
+// ------------------------------------------------------------------
+// Stat pattern
+type StatPattern int
+
+var EStatPattern = StatPattern(0).INVALID_STAT_PATTERN()
+
+func (StatPattern) INVALID_STAT_PATTERN() StatPattern {
+	return StatPattern(0)
+}
+
+// Files in the order they are generated, like a tree walk
+func (StatPattern) SEQUENTIAL() StatPattern {
+	return StatPattern(1)
+}
+
+// Every file equally likely
+func (StatPattern) RANDOM() StatPattern {
+	return StatPattern(2)
+}
+
+// Few hot files get most of the calls, skew is given by --stat-zipf
+func (StatPattern) ZIPF() StatPattern {
+	return StatPattern(3)
+}
+
+func (f StatPattern) String() string {
+	return enum.StringInt(f, reflect.TypeOf(f))
+}
+
+func (a *StatPattern) Parse(s string) error {
+	enumVal, err := enum.ParseInt(reflect.TypeOf(a), s, true, false)
+	if enumVal != nil {
+		*a = enumVal.(StatPattern)
+	}
+
+	return err
+}
+
+// ------------------------------------------------------------------
+
+// validateStat : stat workload only reads metadata of an existing data set so it replaces the single task modes
+func validateStat() error {
+	if !config.Stat {
+		return nil
+	}
+
+	err := config.StatPattern.Parse(config.StatPatternStr)
+	if err != nil || config.StatPattern == EStatPattern.INVALID_STAT_PATTERN() {
+		return fmt.Errorf("invalid stat pattern %s", config.StatPatternStr)
+	}
+
+	if config.StatZipf <= 0 {
+		return fmt.Errorf("stat zipf skew should be greater than 0")
+	}
+
+	if config.StatList < 0 || config.StatList > 100 {
+		return fmt.Errorf("stat list percentage should be between 0 and 100")
+	}
+
+	if config.StatOps < 0 {
+		return fmt.Errorf("stat ops can not be negative")
+	}
+
+	if config.Delete || config.SetTier || config.Verify || config.Read || config.MixStr != "" || config.CreateStub || config.DeleteStub {
+		return fmt.Errorf("stat can not be used along with delete, set-tier, verify, read, mix or stub modes")
+	}
+
+	if config.ManifestOutPath != "" {
+		return fmt.Errorf("manifest-out can not be used with stat")
+	}
+
+	return nil
+}
+
+// -------------------------------------------------------------------
+
+// statWorkload : get properties and list calls over files of a pre-populated data set
+type statWorkload struct {
+	names []string  // Files of the data set in the order they are generated
+	cdf   []float64 // Cumulative probability of each rank, only for zipf pattern
+	rank  []int     // File at each rank, hot files are spread over the data set
+}
+
+// newStatWorkload : collect files of the data set and prepare the zipf distribution over them
+func newStatWorkload() (*statWorkload, error) {
+	s := &statWorkload{}
+	forEachJob(func(job workItem) {
+		if job.objtype == EObjectType.FILE() {
+			s.names = append(s.names, job.path)
+		}
+	})
+
+	if len(s.names) == 0 {
+		return nil, fmt.Errorf("data set has no files for stat to work on")
+	}
+
+	if config.StatPattern == EStatPattern.ZIPF() {
+		s.cdf = make([]float64, len(s.names))
+		total := float64(0)
+		for i := range s.cdf {
+			total += 1 / math.Pow(float64(i+1), config.StatZipf)
+			s.cdf[i] = total
+		}
+		for i := range s.cdf {
+			s.cdf[i] /= total
+		}
+
+		// Without shuffling the hot files would all be in the first directory
+		s.rank = rand.New(rand.NewSource(int64(splitmix64(uint64(config.Seed) ^ statRankSalt)))).Perm(len(s.names))
+	}
+
+	return s, nil
+}
+
+// getOpsPerPass : calls made in one pass, by default as many as files in the data set
+func (s *statWorkload) getOpsPerPass() int64 {
+	if config.StatOps > 0 {
+		return config.StatOps
+	}
+	return int64(len(s.names))
+}
+
+// pickFile : file of the given position in the sequence of calls, same seed gives same sequence
+func (s *statWorkload) pickFile(seq int64) string {
+	if config.StatPattern == EStatPattern.SEQUENTIAL() {
+		return s.names[seq%int64(len(s.names))]
+	}
+
+	u := float64(splitmix64(uint64(config.Seed)^statTargetSalt+uint64(seq))>>11) / (1 << 53)
+	if config.StatPattern == EStatPattern.RANDOM() {
+		return s.names[int(u*float64(len(s.names)))]
+	}
+
+	idx := sort.SearchFloat64s(s.cdf, u)
+	if idx >= len(s.cdf) {
+		idx = len(s.cdf) - 1
+	}
+	return s.names[s.rank[idx]]
+}
+
+// isList : call of the given position lists the directory of its file instead of getting its properties
+func (s *statWorkload) isList(seq int64) bool {
+	if config.StatList <= 0 {
+		return false
+	}
+
+	u := float64(splitmix64(uint64(config.Seed)^statListSalt+uint64(seq))>>11) / (1 << 53)
+	return u*100 < config.StatList
+}
+
+// forEachJob : call fn with each call of given pass
+func (s *statWorkload) forEachJob(pass int64, fn func(job workItem)) {
+	count := s.getOpsPerPass()
+	for i := int64(0); i < count; i++ {
+		seq := pass*count + i
+		name := s.pickFile(seq)
+		job := workItem{path: name, op: EOpType.GET_PROPERTIES(), objtype: EObjectType.FILE(), status: EJobStatusType.WAIT()}
+
+		if s.isList(seq) {
+			// First page of the directory holding the file, like a file system listing it before a stat
+			job.op = EOpType.LIST()
+			job.path = ""
+			if dir := path.Dir(name); dir != "." {
+				job.path = dir + "/"
+			}
+		}
+		fn(job)
+	}
+}
+
+// run : perform the get properties or list call of the job
+func (s *statWorkload) run(ctx context.Context, job *workItem) error {
+	if job.op == EOpType.LIST() {
+		pager := kalpavriksha.storage.ListBlobs(job.path)
+		_, err := pager.NextPage(ctx)
+		return err
+	}
+
+	_, err := kalpavriksha.storage.GetProperties(ctx, job.path)
+	return err
+}
+
+// Workers for stat workload
+func statWorker(ctx context.Context, w int) {
+	defer kalpavriksha.wgWorkers.Done()
+	sched := newWorkerSchedule()
+
+	for job := range kalpavriksha.jobs {
+		if isWindowOver() {
+			continue
+		}
+
+		jobCtx, ok := startJob(ctx, sched, &job)
+		if !ok {
+			continue
+		}
+
+		job.workerId = w
+		atomic.AddInt64(&WaitCount, -1)
+
+		job.status = EJobStatusType.INPROGRESS()
+
+		opCtx, cancel := withOpTimeout(jobCtx)
+		err := kalpavriksha.stat.run(opCtx, &job)
+		cancel()
+
+		if err != nil {
+			log.Printf("(%d) Failed to %s %s (%s)\n", w, getOpName(job.op), job.path, err.Error())
+			job.status = EJobStatusType.FAILED()
+		} else {
+			job.status = EJobStatusType.SUCCESS()
+		}
+
+		atomic.AddInt64(&WaitCount, 1)
+		kalpavriksha.results <- job
+	}
+}
@@ -0,0 +1,524 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/bits"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/JeffreyRichter/enum/enum"
+)
+
+// ------------------------------------------------------------------
+// Operation type
+type OpType int
+
+var EOpType = OpType(0).INVALID_OP()
+
+func (OpType) INVALID_OP() OpType {
+	return OpType(0)
+}
+
+func (OpType) UPLOAD() OpType {
+	return OpType(1)
+}
+
+func (OpType) DOWNLOAD() OpType {
+	return OpType(2)
+}
+
+func (OpType) DELETE() OpType {
+	return OpType(3)
+}
+
+func (OpType) SET_TIER() OpType {
+	return OpType(4)
+}
+
+func (OpType) CREATE_STUB() OpType {
+	return OpType(5)
+}
+
+func (OpType) GET_PROPERTIES() OpType {
+	return OpType(6)
+}
+
+func (OpType) LIST() OpType {
+	return OpType(7)
+}
+
+func (f OpType) String() string {
+	return enum.StringInt(f, reflect.TypeOf(f))
+}
+
+func (a *OpType) Parse(s string) error {
+	enumVal, err := enum.ParseInt(reflect.TypeOf(a), s, true, false)
+	if enumVal != nil {
+		*a = enumVal.(OpType)
+	}
+
+	return err
+}
+
+// ------------------------------------------------------------------
+
+// Latency histogram keeps 2^histSubBits buckets per power of two, which bounds the error of any
+// reported percentile to under 1% of the value
+const (
+	histSubBits    = 7
+	histSubBuckets = 1 << histSubBits
+	histMaxShift   = 40 // Latencies are in microseconds, anything beyond 2^47us lands in the last bucket
+	histLen        = (histMaxShift + 2) * histSubBuckets
+)
+
+// Upper limit of each size bucket, operations are reported per bucket along with a total
+var sizeBucketLimits = []int64{
+	0,
+	4 * 1024,
+	64 * 1024,
+	1024 * 1024,
+	16 * 1024 * 1024,
+	256 * 1024 * 1024,
+}
+
+// Percentiles reported for each operation
+var statsPercentiles = []float64{50, 90, 99, 99.9}
+
+// histogram : log-linear histogram of latencies in microseconds
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    uint64
+	min    uint64
+	max    uint64
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]uint64, histLen)}
+}
+
+// getHistIndex : values below 2^(histSubBits+1) get a bucket each, above that each power of two
+// is split into histSubBuckets equal parts
+func getHistIndex(v uint64) int {
+	shift := bits.Len64(v) - histSubBits - 1
+	if shift <= 0 {
+		return int(v)
+	}
+	if shift > histMaxShift {
+		return histLen - 1
+	}
+	return shift*histSubBuckets + int(v>>shift)
+}
+
+// getHistValue : highest value which falls in the bucket at the given index
+func getHistValue(idx int) uint64 {
+	if idx < 2*histSubBuckets {
+		return uint64(idx)
+	}
+	shift := idx/histSubBuckets - 1
+	mantissa := uint64(idx - shift*histSubBuckets)
+	return (mantissa+1)<<shift - 1
+}
+
+func (h *histogram) record(v uint64) {
+	h.counts[getHistIndex(v)]++
+
+	if h.count == 0 || v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+	h.count++
+	h.sum += v
+}
+
+func (h *histogram) merge(o *histogram) {
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	if o.count > 0 && (h.count == 0 || o.min < h.min) {
+		h.min = o.min
+	}
+	if o.max > h.max {
+		h.max = o.max
+	}
+	h.count += o.count
+	h.sum += o.sum
+}
+
+// percentile : value below which the given percent of recorded values fall
+func (h *histogram) percentile(p float64) uint64 {
+	if h.count == 0 {
+		return 0
+	}
+
+	target := uint64(p / 100 * float64(h.count))
+	if float64(target) < p/100*float64(h.count) || target == 0 {
+		target++
+	}
+
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= target {
+			v := getHistValue(i)
+			if v > h.max {
+				v = h.max
+			}
+			return v
+		}
+	}
+	return h.max
+}
+
+// ------------------------------------------------------------------
+
+// opStats : latency and volume of one operation type in one size bucket
+type opStats struct {
+	latency *histogram
+	bytes   int64
+	errors  int64
+}
+
+func newOpStats() *opStats {
+	return &opStats{latency: newHistogram()}
+}
+
+func (s *opStats) merge(o *opStats) {
+	s.latency.merge(o.latency)
+	s.bytes += o.bytes
+	s.errors += o.errors
+}
+
+type statsKey struct {
+	op     OpType
+	bucket int
+}
+
+// errorKey : failed calls are counted by operation and error code, see getErrorCode
+type errorKey struct {
+	op   OpType
+	code string
+}
+
+// statsCollector : stats of all operations since start of the run, and since last periodic report
+type statsCollector struct {
+	sync.Mutex
+	start      time.Time
+	lastReport time.Time
+	total      map[statsKey]*opStats
+	interval   map[statsKey]*opStats
+	errors     map[errorKey]int64
+	inflight   int64 // Operations started but not yet completed, updated atomically
+}
+
+func newStatsCollector() *statsCollector {
+	return &statsCollector{
+		start:      time.Now(),
+		lastReport: time.Now(),
+		total:      make(map[statsKey]*opStats),
+		interval:   make(map[statsKey]*opStats),
+		errors:     make(map[errorKey]int64),
+	}
+}
+
+// getSizeBucket : index of first bucket whose limit is not below the size, last one is unbounded
+func getSizeBucket(size int64) int {
+	for i, limit := range sizeBucketLimits {
+		if size <= limit {
+			return i
+		}
+	}
+	return len(sizeBucketLimits)
+}
+
+func getSizeBucketName(bucket int) string {
+	if bucket == 0 {
+		return "0B"
+	} else if bucket >= len(sizeBucketLimits) {
+		return ">" + formatSize(sizeBucketLimits[len(sizeBucketLimits)-1])
+	}
+	return formatSize(sizeBucketLimits[bucket-1]) + "-" + formatSize(sizeBucketLimits[bucket])
+}
+
+// getOpName : name of operation as shown in stats e.g. set-tier
+func getOpName(op OpType) string {
+	return strings.ReplaceAll(strings.ToLower(op.String()), "_", "-")
+}
+
+// begin : mark start of an operation, each call is followed by a record once it completes
+func (sc *statsCollector) begin(ctx context.Context) time.Time {
+	atomic.AddInt64(&sc.inflight, 1)
+	return getOpStart(ctx)
+}
+
+// record : add one completed operation, failed operations are only counted as errors so that
+// fast failures do not distort latency
+func (sc *statsCollector) record(op OpType, size int64, start time.Time, err error) {
+	elapsed := time.Since(start)
+	atomic.AddInt64(&sc.inflight, -1)
+	key := statsKey{op: op, bucket: getSizeBucket(size)}
+
+	sc.Lock()
+	defer sc.Unlock()
+
+	if err != nil {
+		sc.errors[errorKey{op: op, code: getErrorCode(err)}]++
+	}
+
+	for _, m := range []map[statsKey]*opStats{sc.total, sc.interval} {
+		s, ok := m[key]
+		if !ok {
+			s = newOpStats()
+			m[key] = s
+		}
+
+		if err != nil {
+			s.errors++
+			continue
+		}
+		s.latency.record(uint64(elapsed.Microseconds()))
+		s.bytes += size
+	}
+}
+
+// summarize : stats merged across size buckets for each operation type
+func summarize(m map[statsKey]*opStats) map[OpType]*opStats {
+	ops := make(map[OpType]*opStats)
+	for key, s := range m {
+		if _, ok := ops[key.op]; !ok {
+			ops[key.op] = newOpStats()
+		}
+		ops[key.op].merge(s)
+	}
+	return ops
+}
+
+// getOpTypes : operation types present in stats, in enum order so that output is stable
+func getOpTypes(m map[statsKey]*opStats) []OpType {
+	seen := make(map[OpType]bool)
+	for key := range m {
+		seen[key.op] = true
+	}
+
+	ops := []OpType{}
+	for op := EOpType.UPLOAD(); op <= EOpType.LIST(); op++ {
+		if seen[op] {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+func formatLatency(us uint64) string {
+	d := time.Duration(us) * time.Microsecond
+	switch {
+	case d >= time.Second:
+		return fmt.Sprintf("%.2fs", d.Seconds())
+	case d >= time.Millisecond:
+		return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond))
+	default:
+		return fmt.Sprintf("%dus", us)
+	}
+}
+
+func formatRate(s *opStats, elapsed time.Duration) (string, string) {
+	secs := elapsed.Seconds()
+	if secs <= 0 {
+		return "-", "-"
+	}
+	return fmt.Sprintf("%.1f", float64(s.latency.count)/secs), fmt.Sprintf("%.2f", float64(s.bytes)/(1024*1024)/secs)
+}
+
+// reportInterval : one line per operation type covering operations since the last report
+func (sc *statsCollector) reportInterval() {
+	sc.Lock()
+	now := time.Now()
+	elapsed := now.Sub(sc.lastReport)
+	ops := summarize(sc.interval)
+	types := getOpTypes(sc.interval)
+	sc.interval = make(map[statsKey]*opStats)
+	sc.lastReport = now
+	sc.Unlock()
+
+	runTime := now.Sub(sc.start).Round(time.Second)
+	for _, op := range types {
+		s := ops[op]
+		opsRate, mbRate := formatRate(s, elapsed)
+		line := fmt.Sprintf("[%s] %s: %s ops/s, %s MB/s, p50 %s, p99 %s, max %s, errors %d",
+			runTime, getOpName(op), opsRate, mbRate,
+			formatLatency(s.latency.percentile(50)), formatLatency(s.latency.percentile(99)), formatLatency(s.latency.max), s.errors)
+		log.Println(line)
+		fmt.Println(line)
+	}
+}
+
+// reportSummary : table of all operations since start of the run, by operation and size bucket
+func (sc *statsCollector) reportSummary(w io.Writer) {
+	sc.Lock()
+	defer sc.Unlock()
+
+	if len(sc.total) == 0 {
+		return
+	}
+
+	elapsed := time.Since(sc.start)
+	ops := summarize(sc.total)
+
+	fmt.Fprintf(w, "Operation stats over %s\n", elapsed.Round(time.Millisecond))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "op\tsize\tcount\terrors\tops/s\tMB/s\t")
+	for _, p := range statsPercentiles {
+		fmt.Fprintf(tw, "p%g\t", p)
+	}
+	fmt.Fprint(tw, "max\t\n")
+
+	writeRow := func(op OpType, size string, s *opStats) {
+		opsRate, mbRate := formatRate(s, elapsed)
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\t", getOpName(op), size, s.latency.count, s.errors, opsRate, mbRate)
+		for _, p := range statsPercentiles {
+			fmt.Fprintf(tw, "%s\t", formatLatency(s.latency.percentile(p)))
+		}
+		fmt.Fprintf(tw, "%s\t\n", formatLatency(s.latency.max))
+	}
+
+	for _, op := range getOpTypes(sc.total) {
+		// Breakdown by size is skipped when all calls fell in one bucket, e.g. calls without data
+		buckets := []int{}
+		for bucket := 0; bucket <= len(sizeBucketLimits); bucket++ {
+			if _, ok := sc.total[statsKey{op: op, bucket: bucket}]; ok {
+				buckets = append(buckets, bucket)
+			}
+		}
+
+		if len(buckets) > 1 {
+			for _, bucket := range buckets {
+				writeRow(op, getSizeBucketName(bucket), sc.total[statsKey{op: op, bucket: bucket}])
+			}
+		}
+		writeRow(op, "all", ops[op])
+	}
+	tw.Flush()
+}
+
+// startStatsReporter : print interval stats periodically until the returned function is called
+func startStatsReporter(sc *statsCollector, interval time.Duration) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				sc.reportInterval()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// printStats : final summary of all operations, on console and in the log
+func printStats(sc *statsCollector) {
+	var sb strings.Builder
+	sc.reportSummary(&sb)
+	if sb.Len() == 0 {
+		return
+	}
+
+	log.Print(sb.String())
+	fmt.Fprint(os.Stdout, sb.String())
+}
+
+// ------------------------------------------------------------------
+
+// statsStorage : wraps the storage and times every call made on it
+type statsStorage struct {
+	Storage
+	stats *statsCollector
+}
+
+func (s *statsStorage) UploadData(ctx context.Context, name string, data []byte, o *UploadOptions) error {
+	start := s.stats.begin(ctx)
+	err := s.Storage.UploadData(ctx, name, data, o)
+	s.stats.record(EOpType.UPLOAD(), int64(len(data)), start, err)
+	return err
+}
+
+func (s *statsStorage) UploadStream(ctx context.Context, name string, r io.ReaderAt, size int64, o *UploadOptions) error {
+	start := s.stats.begin(ctx)
+	err := s.Storage.UploadStream(ctx, name, r, size, o)
+	s.stats.record(EOpType.UPLOAD(), size, start, err)
+	return err
+}
+
+func (s *statsStorage) DownloadData(ctx context.Context, name string, offset int64, count int64) ([]byte, error) {
+	start := s.stats.begin(ctx)
+	data, err := s.Storage.DownloadData(ctx, name, offset, count)
+	s.stats.record(EOpType.DOWNLOAD(), int64(len(data)), start, err)
+	return data, err
+}
+
+func (s *statsStorage) Delete(ctx context.Context, name string, o *DeleteOptions) error {
+	start := s.stats.begin(ctx)
+	err := s.Storage.Delete(ctx, name, o)
+	s.stats.record(EOpType.DELETE(), 0, start, err)
+	return err
+}
+
+func (s *statsStorage) SetTier(ctx context.Context, name string, tier blob.AccessTier) error {
+	start := s.stats.begin(ctx)
+	err := s.Storage.SetTier(ctx, name, tier)
+	s.stats.record(EOpType.SET_TIER(), 0, start, err)
+	return err
+}
+
+func (s *statsStorage) CreateStub(ctx context.Context, name string) error {
+	start := s.stats.begin(ctx)
+	err := s.Storage.CreateStub(ctx, name)
+	s.stats.record(EOpType.CREATE_STUB(), 0, start, err)
+	return err
+}
+
+func (s *statsStorage) GetProperties(ctx context.Context, name string) (blob.GetPropertiesResponse, error) {
+	start := s.stats.begin(ctx)
+	prop, err := s.Storage.GetProperties(ctx, name)
+	s.stats.record(EOpType.GET_PROPERTIES(), 0, start, err)
+	return prop, err
+}
+
+// ListBlobs : each page fetched is timed as one list operation
+func (s *statsStorage) ListBlobs(name string) *runtime.Pager[container.ListBlobsHierarchyResponse] {
+	pager := s.Storage.ListBlobs(name)
+
+	return runtime.NewPager(runtime.PagingHandler[container.ListBlobsHierarchyResponse]{
+		More: func(page container.ListBlobsHierarchyResponse) bool {
+			return pager.More()
+		},
+		Fetcher: func(ctx context.Context, page *container.ListBlobsHierarchyResponse) (container.ListBlobsHierarchyResponse, error) {
+			start := s.stats.begin(ctx)
+			resp, err := pager.NextPage(ctx)
+			s.stats.record(EOpType.LIST(), 0, start, err)
+			return resp, err
+		},
+	})
+}
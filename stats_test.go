@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestHistBuckets(t *testing.T) {
+	// Small values get a bucket each
+	for v := uint64(0); v < 2*histSubBuckets; v++ {
+		if idx := getHistIndex(v); getHistValue(idx) != v {
+			t.Fatalf("value %d maps to bucket %d holding up to %d", v, idx, getHistValue(idx))
+		}
+	}
+
+	// Larger ones land in a bucket no wider than 1/histSubBuckets of its values
+	for _, v := range []uint64{256, 257, 1000, 12345, 1 << 20, 1<<32 + 7} {
+		idx := getHistIndex(v)
+		low, high := getHistValue(idx-1)+1, getHistValue(idx)
+		if v < low || v > high {
+			t.Errorf("value %d outside its bucket [%d, %d]", v, low, high)
+		}
+		if high-low > high/histSubBuckets {
+			t.Errorf("bucket [%d, %d] of value %d is too wide", low, high, v)
+		}
+	}
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	h := newHistogram()
+	if h.percentile(50) != 0 {
+		t.Errorf("empty histogram should report 0")
+	}
+
+	for v := uint64(1); v <= 100; v++ {
+		h.record(v)
+	}
+	if p := h.percentile(50); p != 50 {
+		t.Errorf("p50 of 1..100 is %d", p)
+	}
+	if p := h.percentile(99); p != 99 {
+		t.Errorf("p99 of 1..100 is %d", p)
+	}
+	if p := h.percentile(100); p != 100 {
+		t.Errorf("p100 of 1..100 is %d", p)
+	}
+
+	// Values past exact buckets are reported within bucket width and never above max
+	h = newHistogram()
+	for v := uint64(1000); v <= 1000000; v += 1000 {
+		h.record(v)
+	}
+	p99 := h.percentile(99)
+	if p99 < 990000 || p99 > 990000+990000/histSubBuckets {
+		t.Errorf("p99 is %d, expected about 990000", p99)
+	}
+	if h.percentile(99.99) > h.max {
+		t.Errorf("p99.99 is above max %d", h.max)
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	a, b := newHistogram(), newHistogram()
+	for v := uint64(1); v <= 50; v++ {
+		a.record(v)
+		b.record(v + 50)
+	}
+
+	a.merge(b)
+	if a.count != 100 || a.min != 1 || a.max != 100 || a.sum != 5050 {
+		t.Errorf("merged count %d min %d max %d sum %d", a.count, a.min, a.max, a.sum)
+	}
+	if p := a.percentile(50); p != 50 {
+		t.Errorf("merged p50 is %d", p)
+	}
+}
@@ -1,22 +1,34 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	golog "log"
+	"net/http"
+	"net/url"
 	"os"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync/atomic"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/log"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
 	"github.com/JeffreyRichter/enum/enum"
+	"github.com/minio/minio-go/v7"
 )
 
 const (
 	responseStatusString = "RESPONSE Status:"
+	retryTryString       = "=====> Try="
+	listMaxResults       = 5000
 )
 
 // ------------------------------------------------------------------
@@ -41,6 +53,18 @@ func (StorageType) DATALAKE() StorageType {
 	return StorageType(3)
 }
 
+func (StorageType) LOCAL() StorageType {
+	return StorageType(4)
+}
+
+func (StorageType) MEMORY() StorageType {
+	return StorageType(5)
+}
+
+func (StorageType) S3() StorageType {
+	return StorageType(6)
+}
+
 func (f StorageType) String() string {
 	return enum.StringInt(f, reflect.TypeOf(f))
 }
@@ -57,17 +81,38 @@ func (a *StorageType) Parse(s string) error {
 // ------------------------------------------------------------------
 
 type StorageConfig struct {
-	StorageAccountName      string // Name of the destination storage account
-	StorageAccountKey       string // Key of the destination storage account
-	StorageAccountSAS       string // SAS Key of the destination storage account
-	StorageEndPoint         string // Type of storage account blob/dfs
-	StorageAccountContainer string // Destination container in the storage account
+	StorageAccountName string // Name of the destination storage account
+	StorageAccountKey  string // Key of the destination storage account
+	StorageAccountSAS  string // SAS Key of the destination storage account
+	StorageEndPoint    string // Type of storage account blob/dfs
+	CustomEndpoint     string // Endpoint URL or connection string to use instead of public cloud endpoint
+	EndpointSuffix     string // Endpoint suffix for sovereign clouds e.g. core.chinacloudapi.cn
+
+	ServiceEndpoints        map[string]string // Service (blob / dfs / file) to endpoint URL given explicitly by user
+	StorageAccountContainer string            // Destination container in the storage account
+	LocalRootPath           string            // Root directory when generating data on local / mounted filesystem
+	MemoryDumpPath          string            // File where contents of memory storage are dumped at the end
+
+	S3Endpoint     string // Endpoint of S3 compatible store as URL or host:port
+	S3Bucket       string // Destination bucket in the S3 store
+	S3AccessKey    string // Access key id for S3 store
+	S3SecretKey    string // Secret access key for S3 store
+	S3SessionToken string // Optional session token for S3 store
+	S3Region       string // Region of the S3 bucket
+
+	AuthTypeStr        string   // Auth method asked by user key / sas / spn / workload_identity
+	AuthType           AuthType // Auth method selected to connect to storage account
+	TenantID           string   // Tenant of the service principal or workload identity
+	ClientID           string   // Client id of the service principal or workload identity
+	ClientSecret       string   // Client secret of the service principal
+	FederatedTokenFile string   // File holding federated token for workload identity
 
-	AccountType     StorageType // Type of storage account Blob / File / Datalake
+	AccountType     StorageType // Type of storage account Blob / File / Datalake / Local / Memory / S3
 	DestinationPath string      // Provide destination path (post container)
 
 	UpdateMD5 bool            // Set MD5SUM on upload
 	BlobTier  blob.AccessTier // Set tier value on upload
+	BlockSize int64           // Size of each block when file is uploaded as a stream
 }
 
 type UploadOptions struct {
@@ -76,25 +121,33 @@ type UploadOptions struct {
 }
 
 type DeleteOptions struct {
+	IsStub    bool // Object being deleted is a directory stub
+	Recursive bool // Object being deleted is a directory, delete it along with its contents
 }
 
 type Storage interface {
 	Init() error
-	TestConnection() error
-	UploadData(name string, data []byte, o *UploadOptions) error
-	Delete(name string, o *DeleteOptions) error
-	SetTier(name string, tier blob.AccessTier) error
-	CreateStub(name string) error
+	TestConnection(ctx context.Context) error
+	UploadData(ctx context.Context, name string, data []byte, o *UploadOptions) error
+	UploadStream(ctx context.Context, name string, r io.ReaderAt, size int64, o *UploadOptions) error
+	DownloadData(ctx context.Context, name string, offset int64, count int64) ([]byte, error)
+	Delete(ctx context.Context, name string, o *DeleteOptions) error
+	SetTier(ctx context.Context, name string, tier blob.AccessTier) error
+	CreateStub(ctx context.Context, name string) error
 	ListBlobs(name string) *runtime.Pager[container.ListBlobsHierarchyResponse]
-	GetProperties(name string) (blob.GetPropertiesResponse, error)
+	GetProperties(ctx context.Context, name string) (blob.GetPropertiesResponse, error)
 }
 
 func setupLogging() {
-	log.SetEvents(log.EventRequest, log.EventResponse)
+	log.SetEvents(log.EventRequest, log.EventResponse, log.EventRetryPolicy)
 	log.SetListener(func(cls log.Event, msg string) {
 		switch cls {
-		case log.EventRequest:
 		case log.EventRetryPolicy:
+			// Every attempt after the first one of a call is a retry
+			if strings.HasPrefix(msg, retryTryString) && msg != retryTryString+"1" {
+				atomic.AddInt64(&storageRetries, 1)
+			}
+		case log.EventRequest:
 		case log.EventLRO:
 			// We do not want to log the request
 			break
@@ -116,16 +169,70 @@ func setupLogging() {
 	})
 }
 
-func readStorageParams() {
+func readStorageParams() error {
 	config.BlobTier = blob.AccessTier(config.Tier)
-	config.AccountType = EStorageType.BLOB()
-	config.StorageAccountName = os.Getenv(EnvAzStorageAccount)
-	config.StorageAccountKey = os.Getenv(EnvAzStorageAccessKey)
-	config.StorageAccountSAS = os.Getenv(EnvAzStorageSAS)
+
+	// "dfs" is the endpoint name for datalake accounts
+	if strings.ToLower(config.StorageEndPoint) == "dfs" {
+		config.AccountType = EStorageType.DATALAKE()
+	} else {
+		err := config.AccountType.Parse(config.StorageEndPoint)
+		if err != nil {
+			return fmt.Errorf("invalid account type %s", config.StorageEndPoint)
+		}
+	}
+
+	// Blob client is used for datalake as well, dfs and file endpoints are derived from account name separately
+	config.StorageEndPoint = "blob"
+
+	if config.AccountType == EStorageType.LOCAL() {
+		if config.LocalRootPath == "" {
+			return fmt.Errorf("local-path is required for local account type")
+		}
+		return nil
+	} else if config.AccountType == EStorageType.MEMORY() {
+		return nil
+	} else if config.AccountType == EStorageType.S3() {
+		config.S3Endpoint = os.Getenv(EnvS3Endpoint)
+		config.S3Bucket = os.Getenv(EnvS3Bucket)
+		config.S3AccessKey = os.Getenv(EnvS3AccessKey)
+		config.S3SecretKey = os.Getenv(EnvS3SecretKey)
+		config.S3SessionToken = os.Getenv(EnvS3SessionToken)
+		config.S3Region = os.Getenv(EnvS3Region)
+
+		if config.S3Endpoint == "" || config.S3Bucket == "" {
+			return fmt.Errorf("%s and %s are required for s3 account type", EnvS3Endpoint, EnvS3Bucket)
+		}
+		return nil
+	}
+
+	err := readAuthParams()
+	if err != nil {
+		return err
+	}
 	config.StorageAccountContainer = os.Getenv(EnvAzStorageAccountContainer)
+
+	if config.CustomEndpoint == "" {
+		config.CustomEndpoint = os.Getenv(EnvAzStorageEndpoint)
+	}
+
+	err = config.resolveEndpoints()
+	if err != nil {
+		return err
+	}
+
+	// Connection string may have filled in key or SAS so auth is decided only after endpoints are resolved
+	return config.selectAuthType()
 }
 
-func createStorage(t StorageType, c StorageConfig) (Storage, error) {
+// isAzureStorage : account type is served by Azure Storage and needs Azure credentials
+func (c *StorageConfig) isAzureStorage() bool {
+	return c.AccountType == EStorageType.BLOB() ||
+		c.AccountType == EStorageType.DATALAKE() ||
+		c.AccountType == EStorageType.FILE()
+}
+
+func createStorage(ctx context.Context, t StorageType, c StorageConfig) (Storage, error) {
 	// Setup logging for storage SDK
 	setupLogging()
 
@@ -133,6 +240,16 @@ func createStorage(t StorageType, c StorageConfig) (Storage, error) {
 
 	if t == EStorageType.BLOB() {
 		stobj = &BlobStorage{StorageConfig: c}
+	} else if t == EStorageType.LOCAL() {
+		stobj = &LocalStorage{StorageConfig: c}
+	} else if t == EStorageType.MEMORY() {
+		stobj = &MemoryStorage{StorageConfig: c}
+	} else if t == EStorageType.S3() {
+		stobj = &S3Storage{StorageConfig: c}
+	} else if t == EStorageType.DATALAKE() {
+		stobj = &DatalakeStorage{BlobStorage: BlobStorage{StorageConfig: c}}
+	} else if t == EStorageType.FILE() {
+		stobj = &FileShareStorage{StorageConfig: c}
 	} else {
 		return nil, fmt.Errorf("invalid storage type")
 	}
@@ -142,10 +259,133 @@ func createStorage(t StorageType, c StorageConfig) (Storage, error) {
 		return nil, err
 	}
 
-	err = stobj.TestConnection()
+	if c.isAzureStorage() {
+		fmt.Printf("Using %s auth for %s account %s\n", c.AuthType, t, c.StorageAccountName)
+		golog.Printf("Using %s auth for %s account %s\n", c.AuthType, t, c.StorageAccountName)
+	}
+
+	opCtx, cancel := withOpTimeout(ctx)
+	defer cancel()
+
+	err = stobj.TestConnection(opCtx)
 	if err != nil {
 		return nil, err
 	}
 
 	return stobj, nil
 }
+
+// newStaticListPager : wrap an already computed listing into the pager type returned by ListBlobs
+// Backends which do not talk to blob endpoint use this so that list consumers work unchanged
+func newStaticListPager(prefix string, items []*container.BlobItem, prefixes []*container.BlobPrefix) *runtime.Pager[container.ListBlobsHierarchyResponse] {
+	// Prefixes are served first and then the blobs, each page holding at most listMaxResults entries
+	total := len(prefixes) + len(items)
+	next := 0
+
+	return runtime.NewPager(runtime.PagingHandler[container.ListBlobsHierarchyResponse]{
+		More: func(page container.ListBlobsHierarchyResponse) bool {
+			return page.NextMarker != nil && *page.NextMarker != ""
+		},
+		Fetcher: func(ctx context.Context, page *container.ListBlobsHierarchyResponse) (container.ListBlobsHierarchyResponse, error) {
+			resp := container.ListBlobsHierarchyResponse{}
+			resp.Prefix = to.Ptr(prefix)
+			resp.Delimiter = to.Ptr("/")
+			resp.Segment = &container.BlobHierarchyListSegment{}
+
+			start := next
+			for ; next < total && next-start < listMaxResults; next++ {
+				if next < len(prefixes) {
+					resp.Segment.BlobPrefixes = append(resp.Segment.BlobPrefixes, prefixes[next])
+				} else {
+					resp.Segment.BlobItems = append(resp.Segment.BlobItems, items[next-len(prefixes)])
+				}
+			}
+
+			if next < total {
+				resp.NextMarker = to.Ptr(strconv.Itoa(next))
+			}
+			return resp, nil
+		},
+	})
+}
+
+// forEachBlock : read size bytes from r block by block and hand over each block to fn
+// Same buffer is reused for all the blocks so memory used is bounded by block size irrespective of size
+func forEachBlock(r io.ReaderAt, size int64, blockSize int64, fn func(offset int64, data []byte) error) error {
+	if blockSize <= 0 || blockSize > size {
+		blockSize = size
+	}
+	buf := make([]byte, blockSize)
+
+	for offset := int64(0); offset < size; offset += blockSize {
+		n := blockSize
+		if offset+n > size {
+			n = size - offset
+		}
+
+		read, err := r.ReadAt(buf[:n], offset)
+		if int64(read) < n {
+			if err == nil {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+
+		err = fn(offset, buf[:n])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isNotFoundError : object does not exist, backends report it as a service style 404
+func isNotFoundError(err error) bool {
+	var respErr *azcore.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound
+}
+
+// getErrorCode : short classification of a failed call, HTTP status along with service error code when known
+func getErrorCode(err error) string {
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) {
+		if respErr.ErrorCode != "" {
+			return fmt.Sprintf("%d %s", respErr.StatusCode, respErr.ErrorCode)
+		}
+		return strconv.Itoa(respErr.StatusCode)
+	}
+
+	if s3Err := minio.ToErrorResponse(err); s3Err.StatusCode != 0 {
+		if s3Err.Code != "" {
+			return fmt.Sprintf("%d %s", s3Err.StatusCode, s3Err.Code)
+		}
+		return strconv.Itoa(s3Err.StatusCode)
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	} else if errors.Is(err, context.Canceled) {
+		return "canceled"
+	} else if errors.Is(err, os.ErrNotExist) {
+		return "not found"
+	}
+	return "other"
+}
+
+// newStorageError : build a service style error so that bloberror checks work for non-service backends
+func newStorageError(method string, name string, status int, code bloberror.Code) error {
+	resp := &http.Response{
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode: status,
+		Header:     http.Header{},
+		Body:       http.NoBody,
+		Request: &http.Request{
+			Method: method,
+			URL:    &url.URL{Scheme: "kalpavriksha", Host: config.AccountType.String(), Path: "/" + name},
+		},
+	}
+	resp.Header.Set("x-ms-error-code", string(code))
+
+	return runtime.NewResponseError(resp)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Salts mixed in the key of a directory so that each random choice made for it is independent
+const (
+	fanoutSalt   uint64 = 0xfa40fa40fa40fa40
+	emptyDirSalt uint64 = 0xe3e3e3e3e3e3e3e3
+)
+
+// isTreeShape : data set layout is given as fan-out per level instead of --dirs and --depth
+func isTreeShape() bool {
+	return len(config.Fanout) > 0
+}
+
+// forEachEntry : call fn with name of each file and each empty directory in the data set, in the order they are generated
+func forEachEntry(fn func(name string, objtype ObjectType)) {
+	forEachPassEntry(0, fn)
+}
+
+// forEachPassEntry : same as forEachEntry with names of given pass of --duration, see getPassDir
+func forEachPassEntry(pass int64, fn func(name string, objtype ObjectType)) {
+	if config.PrefixStrategy != EPrefixStrategy.NONE() {
+		// Prefix goes in front of complete path, position of entry is counted over files and directories both
+		entry, visit := int64(0), fn
+		fn = func(name string, objtype ObjectType) {
+			visit(getPrefix(name, entry)+name, objtype)
+			entry++
+		}
+	}
+
+	if passDir := getPassDir(pass); passDir != "" {
+		// Pass directory is added before the prefix so that prefix still spreads the complete path
+		visit := fn
+		fn = func(name string, objtype ObjectType) {
+			visit(passDir+name, objtype)
+		}
+	}
+
+	seq := int64(0)
+	if isTreeShape() {
+		walkTree("", 0, &seq, fn)
+		return
+	}
+
+	depth := ""
+	for i := int64(0); i < config.DirDepth; i++ {
+		depth += fmt.Sprintf("/%d", i+1)
+	}
+
+	for d := (int64)(0); d < config.NumberOfDirs; d++ {
+		slot := nameSlot{dir: fmt.Sprintf("dir-%d%s", d, depth), level: int(config.DirDepth) + 1}
+		for f := (int64)(0); f < config.NumberOfFiles; f++ {
+			slot.file, slot.seq = f, seq
+			fn(config.NameTemplate.getName(&slot), EObjectType.FILE())
+			seq++
+		}
+	}
+}
+
+// forEachTopDir : call fn with name of each directory at the top of the data set
+func forEachTopDir(fn func(name string)) {
+	count := config.NumberOfDirs
+	if isTreeShape() {
+		count = getFanout("", 0)
+	}
+
+	for d := (int64)(0); d < count; d++ {
+		fn(fmt.Sprintf("dir-%d", d))
+	}
+}
+
+// walkTree : visit files and empty directories under dir which is at given level, root being level 0
+// Returns number of entries visited so that a directory left with nothing in it can be created as an empty one
+func walkTree(dir string, level int, seq *int64, fn func(name string, objtype ObjectType)) int64 {
+	fanout := getFanout(dir, level)
+
+	// Files go either in each level as asked or only in leaf directories
+	files := int64(0)
+	if len(config.FilesPerLevel) > 0 {
+		if level > 0 && level <= len(config.FilesPerLevel) {
+			files = config.FilesPerLevel[level-1]
+		}
+	} else if fanout == 0 {
+		files = config.NumberOfFiles
+	}
+
+	slot := nameSlot{dir: strings.TrimSuffix(dir, "/"), level: level}
+	for f := int64(0); f < files; f++ {
+		slot.file, slot.seq = f, *seq
+		fn(config.NameTemplate.getName(&slot), EObjectType.FILE())
+		*seq++
+	}
+
+	count := files
+	for d := int64(0); d < fanout; d++ {
+		child := fmt.Sprintf("%sdir-%d", dir, d)
+		if isEmptyDir(child) || walkTree(child+"/", level+1, seq, fn) == 0 {
+			fn(child, EObjectType.DIR())
+		}
+		count++
+	}
+
+	return count
+}
+
+// getFanout : number of sub-directories of the given directory
+// With jitter fan-out is picked uniformly from fanout * [1 - jitter, 1 + jitter], same for a directory across runs
+func getFanout(dir string, level int) int64 {
+	if level >= len(config.Fanout) {
+		return 0
+	}
+
+	fanout := config.Fanout[level]
+	if config.FanoutJitter > 0 {
+		scale := 1 - config.FanoutJitter + 2*config.FanoutJitter*getDirRandom(dir, fanoutSalt)
+		fanout = int64(math.Round(float64(fanout) * scale))
+		if fanout < 0 {
+			fanout = 0
+		}
+	}
+
+	return fanout
+}
+
+// isEmptyDir : directory is created without any files or sub-directories in it
+func isEmptyDir(dir string) bool {
+	return config.EmptyDirRatio > 0 && getDirRandom(dir, emptyDirSalt) < config.EmptyDirRatio
+}
+
+// getDirRandom : uniform random number in [0, 1) for the directory, derived from seed and its path
+func getDirRandom(dir string, salt uint64) float64 {
+	return float64(splitmix64(seededKey(config.Seed, dir)^salt)>>11) / (1 << 53)
+}
+
+// isSeededLayout : paths in the data set depend on seed
+func isSeededLayout() bool {
+	return config.NameTemplate.seeded || config.PrefixStrategy == EPrefixStrategy.SHARD() ||
+		(isTreeShape() && (config.FanoutJitter > 0 || config.EmptyDirRatio > 0))
+}
+
+// parseLevelCounts : parse comma separated count per level like "10,20,5"
+func parseLevelCounts(s string) ([]int64, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	counts := make([]int64, 0)
+	for _, part := range strings.Split(s, ",") {
+		count, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("invalid count %s in %s", part, s)
+		}
+		counts = append(counts, count)
+	}
+
+	return counts, nil
+}
@@ -67,6 +67,11 @@ func (JobStatusType) FAILED() JobStatusType {
 	return JobStatusType(4)
 }
 
+// Nothing to work on, e.g. mix found no object in the state its operation needs
+func (JobStatusType) SKIPPED() JobStatusType {
+	return JobStatusType(5)
+}
+
 func (f JobStatusType) String() string {
 	return enum.StringInt(f, reflect.TypeOf(f))
 }
@@ -118,6 +123,24 @@ const (
 	EnvAzStorageAccessKey        = "AZURE_STORAGE_ACCESS_KEY"
 	EnvAzStorageSAS              = "AZURE_STORAGE_SAS_TOKEN"
 	EnvAzStorageAccountContainer = "AZURE_STORAGE_ACCOUNT_CONTAINER"
+	EnvAzStorageEndpoint         = "AZURE_STORAGE_ENDPOINT"
+	EnvAzStorageConnectionString = "AZURE_STORAGE_CONNECTION_STRING"
+
+	EnvAzTenantID           = "AZURE_TENANT_ID"
+	EnvAzClientID           = "AZURE_CLIENT_ID"
+	EnvAzClientSecret       = "AZURE_CLIENT_SECRET"
+	EnvAzFederatedTokenFile = "AZURE_FEDERATED_TOKEN_FILE"
+)
+
+// ------------------------------------------------------------------
+// S3 storage related env variables
+const (
+	EnvS3Endpoint     = "S3_ENDPOINT"
+	EnvS3Bucket       = "S3_BUCKET"
+	EnvS3AccessKey    = "AWS_ACCESS_KEY_ID"
+	EnvS3SecretKey    = "AWS_SECRET_ACCESS_KEY"
+	EnvS3SessionToken = "AWS_SESSION_TOKEN"
+	EnvS3Region       = "AWS_REGION"
 )
 
 // ------------------------------------------------------------------
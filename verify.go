@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+)
+
+// Size of each range validated when only sampled ranges of a file are verified
+const verifyRangeSize = 1024 * 1024
+
+// Size of each block in which a complete file is hashed and compared when --block-size is not given
+const verifyBlockSize = 8 * 1024 * 1024
+
+// verifyStats : outcome of verification, updated by all verify workers
+type verifyStats struct {
+	verified        int64 // Files which matched in size, MD5 and content
+	missing         int64 // Files not found in storage
+	sizeMismatch    int64 // Files with size different than expected
+	md5Mismatch     int64 // Files with Content-MD5 different than expected, or than the one in manifest
+	contentMismatch int64 // Files with content different than expected
+	failed          int64 // Files which could not be verified due to errors
+	extra           int64 // Files found in storage which are not part of data set
+}
+
+var verifyResult verifyStats
+
+// Used to stop comparing a file after first mismatch, mismatch itself is already reported
+var errContentMismatch = errors.New("content mismatch")
+
+// Workers for verify task
+func verifyWorker(ctx context.Context, w int) {
+	defer kalpavriksha.wgWorkers.Done()
+	sched := newWorkerSchedule()
+
+	for job := range kalpavriksha.jobs {
+		if isWindowOver() {
+			continue
+		}
+
+		jobCtx, ok := startJob(ctx, sched, &job)
+		if !ok {
+			continue
+		}
+
+		log.Printf("(%d) %s\n", w, job.path)
+		job.workerId = w
+		atomic.AddInt64(&WaitCount, -1)
+
+		job.status = EJobStatusType.INPROGRESS()
+
+		if verifyFile(jobCtx, job.path, job.expected) {
+			atomic.AddInt64(&verifyResult.verified, 1)
+			job.status = EJobStatusType.SUCCESS()
+		} else {
+			job.status = EJobStatusType.FAILED()
+		}
+
+		atomic.AddInt64(&WaitCount, 1)
+		kalpavriksha.results <- job
+	}
+}
+
+// verifyFile : validate size, Content-MD5 and content of the given file against data source
+// When file comes from a manifest, size and MD5 recorded there are validated as well
+func verifyFile(ctx context.Context, name string, expected *manifestEntry) bool {
+	opCtx, cancel := withOpTimeout(ctx)
+	prop, err := kalpavriksha.storage.GetProperties(opCtx, name)
+	cancel()
+
+	if isNotFoundError(err) {
+		log.Printf("Verify : %s is missing\n", name)
+		atomic.AddInt64(&verifyResult.missing, 1)
+		return false
+	} else if err != nil {
+		log.Printf("Verify : failed to get properties of %s (%s)\n", name, err.Error())
+		atomic.AddInt64(&verifyResult.failed, 1)
+		return false
+	}
+
+	size := kalpavriksha.dataSrc.GetSize(name)
+	if expected != nil && expected.Size != size {
+		log.Printf("Verify : %s size in manifest %d does not match data source size %d\n", name, expected.Size, size)
+		atomic.AddInt64(&verifyResult.sizeMismatch, 1)
+		return false
+	}
+
+	if prop.ContentLength == nil || *prop.ContentLength != size {
+		actual := int64(-1)
+		if prop.ContentLength != nil {
+			actual = *prop.ContentLength
+		}
+		log.Printf("Verify : %s size mismatch, expected %d found %d\n", name, size, actual)
+		atomic.AddInt64(&verifyResult.sizeMismatch, 1)
+		return false
+	}
+
+	if expected != nil && expected.MD5 != "" && expected.MD5 != hex.EncodeToString(prop.ContentMD5) {
+		log.Printf("Verify : %s Content-MD5 mismatch, manifest has %s found %x\n", name, expected.MD5, prop.ContentMD5)
+		atomic.AddInt64(&verifyResult.md5Mismatch, 1)
+		return false
+	}
+
+	// Expected content is generated block by block so that large files are verified with bounded memory
+	source := newSourceReader(kalpavriksha.dataSrc, name)
+	blockSize := config.BlockSize
+	if blockSize <= 0 {
+		blockSize = verifyBlockSize
+	}
+
+	// Local storage and streamed uploads to some services keep no Content-MD5, even with --md5, content check covers them
+	if prop.ContentMD5 != nil {
+		md5Sum, err := getStreamMD5Sum(source, size, blockSize)
+		if err != nil {
+			log.Printf("Verify : failed to compute MD5 Sum of %s (%s)\n", name, err.Error())
+			atomic.AddInt64(&verifyResult.failed, 1)
+			return false
+		}
+
+		if !bytes.Equal(prop.ContentMD5, md5Sum) {
+			log.Printf("Verify : %s Content-MD5 mismatch, expected %x found %x\n", name, md5Sum, prop.ContentMD5)
+			atomic.AddInt64(&verifyResult.md5Mismatch, 1)
+			return false
+		}
+	}
+
+	if size == 0 {
+		return true
+	}
+
+	if config.VerifyRanges <= 0 {
+		// Complete file is compared one block at a time
+		matched := true
+		err := forEachBlock(source, size, blockSize, func(offset int64, expectedData []byte) error {
+			opCtx, cancel := withOpTimeout(ctx)
+			data, err := kalpavriksha.storage.DownloadData(opCtx, name, offset, int64(len(expectedData)))
+			cancel()
+			if err != nil {
+				return err
+			}
+
+			matched = verifyContent(name, offset, expectedData, data)
+			if !matched {
+				return errContentMismatch
+			}
+			return nil
+		})
+
+		if err != nil && err != errContentMismatch {
+			log.Printf("Verify : failed to download %s (%s)\n", name, err.Error())
+			atomic.AddInt64(&verifyResult.failed, 1)
+			return false
+		}
+		return matched
+	}
+
+	for i := 0; i < config.VerifyRanges; i++ {
+		offset, count := getVerifyRange(name, size, i)
+
+		opCtx, cancel := withOpTimeout(ctx)
+		data, err := kalpavriksha.storage.DownloadData(opCtx, name, offset, count)
+		cancel()
+
+		if err != nil {
+			log.Printf("Verify : failed to download %s range %d-%d (%s)\n", name, offset, offset+count, err.Error())
+			atomic.AddInt64(&verifyResult.failed, 1)
+			return false
+		}
+
+		expectedData := make([]byte, count)
+		kalpavriksha.dataSrc.ReadAt(name, expectedData, offset)
+
+		if !verifyContent(name, offset, expectedData, data) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// getVerifyRange : pick the i-th range to be validated, same file always gets same ranges for a seed
+func getVerifyRange(name string, size int64, i int) (int64, int64) {
+	count := int64(verifyRangeSize)
+	if count > size {
+		count = size
+	}
+
+	key := seededKey(config.Seed, name)
+	offset := int64(splitmix64(key+uint64(i)*seedGamma) % uint64(size-count+1))
+	return offset, count
+}
+
+// verifyContent : compare downloaded data with expected one and report first mismatching offset
+func verifyContent(name string, offset int64, expected []byte, actual []byte) bool {
+	if bytes.Equal(expected, actual) {
+		return true
+	}
+
+	idx := 0
+	for idx < len(expected) && idx < len(actual) && expected[idx] == actual[idx] {
+		idx++
+	}
+
+	log.Printf("Verify : %s content mismatch at offset %d (expected %d bytes, downloaded %d bytes)\n",
+		name, offset+int64(idx), len(expected), len(actual))
+	atomic.AddInt64(&verifyResult.contentMismatch, 1)
+	return false
+}
+
+// findExtraFiles : walk the destination path and report files which are not part of the data set
+func findExtraFiles(ctx context.Context) {
+	expected := make(map[string]struct{})
+	if config.ManifestPath != "" {
+		err := readManifest(config.ManifestPath, func(e *manifestEntry) {
+			if e.Status == EJobStatusType.SUCCESS().String() {
+				expected[e.Path] = struct{}{}
+			}
+		})
+		if err != nil {
+			log.Printf("Verify : failed to read manifest %s (%s)\n", config.ManifestPath, err.Error())
+			atomic.AddInt64(&verifyResult.failed, 1)
+			return
+		}
+	} else {
+		forEachEntry(func(name string, objtype ObjectType) {
+			expected[name] = struct{}{}
+		})
+	}
+
+	dstPrefix := ""
+	if config.DestinationPath != "" {
+		dstPrefix = strings.TrimSuffix(config.DestinationPath, "/") + "/"
+	}
+
+	dirs := []string{""}
+	for len(dirs) > 0 {
+		dir := dirs[0]
+		dirs = dirs[1:]
+
+		items := make([]*container.BlobItem, 0)
+		prefixes := make(map[string]struct{})
+
+		pager := kalpavriksha.storage.ListBlobs(dir)
+		for pager.More() {
+			opCtx, cancel := withOpTimeout(ctx)
+			resp, err := pager.NextPage(opCtx)
+			cancel()
+
+			if err != nil {
+				log.Printf("Verify : failed to list %s (%s)\n", dir, err.Error())
+				atomic.AddInt64(&verifyResult.failed, 1)
+				break
+			}
+
+			for _, prefix := range resp.Segment.BlobPrefixes {
+				name := strings.TrimPrefix(*prefix.Name, dstPrefix)
+				prefixes[name] = struct{}{}
+				dirs = append(dirs, name)
+			}
+			items = append(items, resp.Segment.BlobItems...)
+		}
+
+		for _, item := range items {
+			name := strings.TrimPrefix(*item.Name, dstPrefix)
+
+			// Directory stubs show up as a blob with the same name as the virtual directory
+			if _, ok := prefixes[name+"/"]; ok || strings.HasSuffix(name, "/") {
+				continue
+			}
+
+			if _, ok := expected[name]; !ok {
+				log.Printf("Verify : %s is not part of the data set\n", name)
+				atomic.AddInt64(&verifyResult.extra, 1)
+			}
+		}
+	}
+}
+
+// reportVerification : print summary of verification
+func reportVerification() {
+	summary := fmt.Sprintf("Verify summary : verified %d, missing %d, size mismatch %d, md5 mismatch %d, content mismatch %d, failed %d, extra %d",
+		verifyResult.verified, verifyResult.missing, verifyResult.sizeMismatch, verifyResult.md5Mismatch,
+		verifyResult.contentMismatch, verifyResult.failed, verifyResult.extra)
+
+	log.Println(summary)
+	fmt.Println(summary)
+}
+
+// verificationFailed : any problem found during verification
+func verificationFailed() bool {
+	if isMultiPass() {
+		// Data set is verified as many times as the window allows so only problems found count
+		return kalpavriksha.itemCounts[EJobStatusType.FAILED()] > 0 || verifyResult.extra > 0 || verifyResult.failed > 0
+	}
+	return verifyResult.verified != countJobs() || verifyResult.extra > 0 || verifyResult.failed > 0
+}
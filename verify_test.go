@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+)
+
+// countingStorage : counts downloads and the largest range asked for, count of 0 asks for the whole file
+type countingStorage struct {
+	Storage
+	downloads int64
+	largest   int64
+	whole     bool
+}
+
+func (c *countingStorage) DownloadData(ctx context.Context, name string, offset int64, count int64) ([]byte, error) {
+	atomic.AddInt64(&c.downloads, 1)
+	if count <= 0 {
+		c.whole = true
+	} else if count > c.largest {
+		c.largest = count
+	}
+	return c.Storage.DownloadData(ctx, name, offset, count)
+}
+
+func TestVerifyFileWithoutBlockSize(t *testing.T) {
+	defer func() {
+		kalpavriksha.storage, kalpavriksha.dataSrc = nil, nil
+		verifyResult = verifyStats{}
+	}()
+
+	size := int64(2*verifyBlockSize + 1024)
+	src := &zeroDataSource{dataSizeConfig: dataSizeConfig{dist: &fixedSize{size: size}}}
+	data, err := src.GetData("f")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ms := newTestMemoryStorage(t, "")
+	err = ms.UploadData(context.Background(), "f", data, &UploadOptions{MD5Sum: src.GetMd5Sum(data)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage := &countingStorage{Storage: ms}
+	kalpavriksha.storage = storage
+	kalpavriksha.dataSrc = src
+	config.BlockSize = 0
+
+	if !verifyFile(context.Background(), "f", nil) {
+		t.Fatalf("file failed to verify, %+v", verifyResult)
+	}
+
+	// Whole file is never read in one go, it is compared in blocks of default size
+	if storage.whole || storage.downloads != 3 || storage.largest != verifyBlockSize {
+		t.Errorf("verified with %d downloads of at most %d bytes", storage.downloads, storage.largest)
+	}
+}
@@ -16,13 +16,18 @@ type workItem struct {
 	path     string
 	objtype  ObjectType
 	status   JobStatusType
+	expected *manifestEntry // Entry of the manifest this job came from, if any
+	intended time.Time      // Start time of the job as per --ops-rate and --bandwidth schedule
+	op       OpType         // Operation of mixed workload, object it works on is picked when it runs
 }
 
 var WaitCount int64 = 0
 var totalProcessedCount int64 = 0
 
-func startWorkers() {
+// startWorkers : run the task with configured parallelism, ctx is parent of every storage call made by workers
+func startWorkers(ctx context.Context) {
 	kalpavriksha.wgWorkers = sync.WaitGroup{}
+	kalpavriksha.itemCounts = make(map[JobStatusType]int64)
 
 	if config.CreateStub || config.DeleteStub {
 		kalpavriksha.jobs = make(chan workItem, 10000000)
@@ -32,18 +37,29 @@ func startWorkers() {
 		kalpavriksha.results = make(chan workItem, config.Parallelism*2)
 	}
 
+	// Queues exist from here on so metrics can report their depth
+	registerMetrics()
+
 	atomic.AddInt64(&WaitCount, int64(config.Parallelism))
 
 	for w := 1; w <= config.Parallelism; w++ {
 		kalpavriksha.wgWorkers.Add(1)
 		if config.CreateStub || config.DeleteStub {
-			go createStubWorker(w)
+			go createStubWorker(ctx, w)
 		} else if config.Delete {
-			go deleteWorker(w)
+			go deleteWorker(ctx, w)
 		} else if config.SetTier {
-			go tierWorker(w)
+			go tierWorker(ctx, w)
+		} else if config.Verify {
+			go verifyWorker(ctx, w)
+		} else if config.Read {
+			go readWorker(ctx, w)
+		} else if kalpavriksha.stat != nil {
+			go statWorker(ctx, w)
+		} else if kalpavriksha.mix != nil {
+			go mixedWorker(ctx, w)
 		} else {
-			go uploadWorker(w)
+			go uploadWorker(ctx, w)
 		}
 	}
 
@@ -63,6 +79,8 @@ func startWorkers() {
 				select {
 				case <-t:
 					log.Printf("Completed item count: %v", atomic.LoadInt64(&totalProcessedCount))
+				case <-kalpavriksha.stop.Done():
+					return
 				}
 			}
 		}()
@@ -73,9 +91,16 @@ func startWorkers() {
 
 		for {
 			select {
-			case _ = <-kalpavriksha.results:
+			case job := <-kalpavriksha.results:
 				completecount++
+				kalpavriksha.itemCounts[job.status]++
 				tickerCount = 0
+			case <-kalpavriksha.stop.Done():
+				// Workers return after the directory they are listing, directories still queued are dropped
+				kalpavriksha.wgWorkers.Wait()
+				log.Printf("Number of stubs processed before stop %d\n", completecount)
+				fmt.Printf("Number of stubs processed before stop %d\n", completecount)
+				return
 			case <-ticker:
 				tickerCount++
 				if atomic.LoadInt64(&WaitCount) == int64(config.Parallelism) {
@@ -96,70 +121,283 @@ func startWorkers() {
 	} else {
 		go createJobs()
 
-		pendingCount := config.NumberOfDirs * config.NumberOfFiles
+		// Multiple passes have no fixed number of items, they go on till --duration is over
+		pendingCount := int64(0)
+		if !isMultiPass() {
+			pendingCount = countJobs()
+		}
 		completecount := int64(0)
+		kalpavriksha.itemsTotal = pendingCount
+
+		// Results are closed once all workers are done, which is earlier than pendingCount when run is stopped
+		go func() {
+			kalpavriksha.wgWorkers.Wait()
+			close(kalpavriksha.results)
+		}()
 
 		for job := range kalpavriksha.results {
 			completecount++
+			kalpavriksha.itemCounts[job.status]++
+
+			if kalpavriksha.journal != nil {
+				if err := kalpavriksha.journal.record(&job); err != nil {
+					log.Printf("Failed to record %s in journal (%s)\n", job.path, err.Error())
+				}
+			}
 
-			log.Printf("Worker %d => %s : %s (%s), job Completion %0.2f\n",
-				job.workerId, job.objtype, job.path, job.status,
-				float64(completecount)*100/float64(pendingCount))
+			if pendingCount > 0 {
+				log.Printf("Worker %d => %s : %s (%s), job Completion %0.2f\n",
+					job.workerId, job.objtype, job.path, job.status,
+					float64(completecount)*100/float64(pendingCount))
+			} else {
+				log.Printf("Worker %d => %s : %s (%s), jobs completed %d\n",
+					job.workerId, job.objtype, job.path, job.status, completecount)
+			}
+		}
 
-			if completecount == pendingCount {
-				close(kalpavriksha.results)
+		if isStopped() {
+			summary := fmt.Sprintf("Stopped after completing %d items", completecount)
+			if pendingCount > 0 {
+				summary = fmt.Sprintf("Stopped after completing %d of %d items", completecount, pendingCount)
 			}
+			log.Println(summary)
+			fmt.Println(summary)
 		}
 
-		kalpavriksha.wgWorkers.Wait()
+		if config.Verify {
+			// Rest of the data set was not verified so looking for extra files would only report noise
+			if !isStopped() {
+				findExtraFiles(ctx)
+			}
+			reportVerification()
+		}
 	}
 }
 
+// deleteDirsRecursively : hierarchical namespace can delete a directory along with its contents in one call
+// Only possible when all files are generated inside the top level directories
+func deleteDirsRecursively() bool {
+	return config.Delete && config.AccountType == EStorageType.DATALAKE() && config.ManifestPath == "" &&
+		config.NameTemplate.isUnderDir() && config.PrefixStrategy == EPrefixStrategy.NONE()
+}
+
+// createJobs : push each item to the job queue till all are pushed or run is stopped
+// With --duration passes over the data set are repeated till it is over
 func createJobs() {
-	depth := ""
-	for i := int64(0); i < config.DirDepth; i++ {
-		depth += fmt.Sprintf("%d/", i+1)
-	}
+	stopped := false
+	sched := newSchedule(config.OpsRate, config.Bandwidth)
+
+	passes := int64(0)
+	for pass := int64(0); !stopped; pass++ {
+		passes++
+		namePass := int64(0)
+		if config.DurationMode == EDurationMode.NEW() {
+			namePass = pass
+		}
+
+		pushed := 0
+		push := func(job workItem) {
+			if stopped {
+				return
+			}
+
+			if sched != nil {
+				// Job is released when it is due, time it then waits in the queue counts towards its latency
+				job.intended = sched.next(getJobBytes(&job))
+				if !waitUntil(job.intended) {
+					stopped = true
+					return
+				}
+			}
 
-	for d := (int64)(0); d < config.NumberOfDirs; d++ {
-		for f := (int64)(0); f < config.NumberOfFiles; f++ {
-			name := fmt.Sprintf("dir-%d/%sfile-%d", d, depth, f)
-			kalpavriksha.jobs <- workItem{
-				path:    name,
-				objtype: EObjectType.FILE(),
-				status:  EJobStatusType.WAIT(),
+			select {
+			case kalpavriksha.jobs <- job:
+				pushed++
+			case <-kalpavriksha.window.Done():
+				// Let workers finish right away, rest of the items are just skipped over
+				stopped = true
 			}
 		}
+
+		if kalpavriksha.mix != nil {
+			kalpavriksha.mix.forEachJob(pass, push)
+		} else if kalpavriksha.stat != nil {
+			kalpavriksha.stat.forEachJob(pass, push)
+		} else {
+			forEachPassJob(namePass, push)
+		}
+
+		if !isMultiPass() || pushed == 0 {
+			break
+		}
 	}
+
 	close(kalpavriksha.jobs)
+
+	if isMultiPass() {
+		log.Printf("Started %d passes over the data set in %s\n", passes, config.Duration)
+		fmt.Printf("Started %d passes over the data set in %s\n", passes, config.Duration)
+	}
+}
+
+// forEachJob : call fn with each item the current task has to work on
+// Empty directories are only of interest while creating or deleting the data set
+func forEachJob(fn func(job workItem)) {
+	forEachPassJob(0, fn)
+}
+
+// forEachPassJob : same as forEachJob with names of given pass of --duration, see getPassDir
+func forEachPassJob(pass int64, fn func(job workItem)) {
+	if kalpavriksha.journal != nil {
+		// Items completed by an earlier run are skipped, failed ones are tried again
+		next := fn
+		fn = func(job workItem) {
+			if !kalpavriksha.journal.isDone(job.path) {
+				next(job)
+			}
+		}
+	}
+
+	withDirs := config.Delete || !(config.SetTier || config.Verify || config.Read || config.Stat)
+
+	if config.ManifestPath != "" {
+		// Only objects which were created successfully are part of the data set
+		err := readManifest(config.ManifestPath, func(e *manifestEntry) {
+			var objtype ObjectType
+			if e.Status != EJobStatusType.SUCCESS().String() || objtype.Parse(e.Type) != nil {
+				return
+			}
+
+			if objtype == EObjectType.FILE() || withDirs {
+				fn(workItem{path: e.Path, objtype: objtype, status: EJobStatusType.WAIT(), expected: e})
+			}
+		})
+		if err != nil {
+			log.Printf("Failed to read manifest %s (%s)\n", config.ManifestPath, err.Error())
+		}
+		return
+	}
+
+	if deleteDirsRecursively() {
+		forEachTopDir(func(name string) {
+			fn(workItem{path: name, objtype: EObjectType.DIR(), status: EJobStatusType.WAIT()})
+		})
+		return
+	}
+
+	forEachPassEntry(pass, func(name string, objtype ObjectType) {
+		if objtype == EObjectType.FILE() || withDirs {
+			fn(workItem{path: name, objtype: objtype, status: EJobStatusType.WAIT()})
+		}
+	})
+}
+
+// countJobs : number of items the current task has to work on
+func countJobs() int64 {
+	if kalpavriksha.mix != nil {
+		return kalpavriksha.mix.getOpsPerPass()
+	} else if kalpavriksha.stat != nil {
+		return kalpavriksha.stat.getOpsPerPass()
+	}
+
+	if !isTreeShape() && config.ManifestPath == "" && kalpavriksha.journal == nil {
+		if deleteDirsRecursively() {
+			return config.NumberOfDirs
+		}
+		return config.NumberOfDirs * config.NumberOfFiles
+	}
+
+	count := int64(0)
+	forEachJob(func(job workItem) {
+		count++
+	})
+	return count
 }
 
 // Workers for upload task
-func uploadWorker(w int) {
+func uploadWorker(ctx context.Context, w int) {
 	defer kalpavriksha.wgWorkers.Done()
+	sched := newWorkerSchedule()
+
 	for job := range kalpavriksha.jobs {
+		if isWindowOver() {
+			continue
+		}
+
+		jobCtx, ok := startJob(ctx, sched, &job)
+		if !ok {
+			continue
+		}
+
 		log.Printf("(%d) %s\n", w, job.path)
 		job.workerId = w
+		atomic.AddInt64(&WaitCount, -1)
 
 		job.status = EJobStatusType.INPROGRESS()
+		start := time.Now()
+
+		opCtx, cancel := withOpTimeout(jobCtx)
+
+		var err error
+		if job.objtype == EObjectType.DIR() {
+			err = kalpavriksha.storage.CreateStub(opCtx, job.path)
+			if bloberror.HasCode(err, bloberror.BlobAlreadyExists) {
+				err = nil
+			}
+		} else if config.BlockSize > 0 {
+			err = uploadFileStream(opCtx, job.path)
+		} else {
+			err = uploadFile(opCtx, job.path)
+		}
+		cancel()
 
-		data, err := kalpavriksha.dataSrc.GetData()
 		if err != nil {
+			log.Printf("(%d) Failed to upload %s (%s)\n", w, job.path, err.Error())
 			job.status = EJobStatusType.FAILED()
 		} else {
-			opt := getUploadOptions(data)
-			err := kalpavriksha.storage.UploadData(job.path, data, opt)
-			if err != nil {
-				job.status = EJobStatusType.FAILED()
-			} else {
-				job.status = EJobStatusType.SUCCESS()
-			}
+			job.status = EJobStatusType.SUCCESS()
+		}
+
+		if kalpavriksha.manifest != nil {
+			recordUpload(ctx, &job, start, err)
 		}
 
+		atomic.AddInt64(&WaitCount, 1)
 		kalpavriksha.results <- job
 	}
 }
 
+// uploadFile : generate complete file in memory and upload it in one go
+func uploadFile(ctx context.Context, name string) error {
+	data, err := kalpavriksha.dataSrc.GetData(name)
+	if err != nil {
+		return err
+	}
+
+	return kalpavriksha.storage.UploadData(ctx, name, data, getUploadOptions(data))
+}
+
+// uploadFileStream : generate and upload the file block by block so memory used per worker is bounded by block size
+func uploadFileStream(ctx context.Context, name string) error {
+	r := newSourceReader(kalpavriksha.dataSrc, name)
+
+	opt := &UploadOptions{}
+	if config.UpdateMD5 {
+		// MD5 Sum is needed before upload is committed so content is generated once just to compute it
+		md5Sum, err := getStreamMD5Sum(r, r.size, config.BlockSize)
+		if err != nil {
+			return err
+		}
+		opt.MD5Sum = md5Sum
+	}
+
+	if config.Tier != "none" {
+		opt.Tier = &config.BlobTier
+	}
+
+	return kalpavriksha.storage.UploadStream(ctx, name, r, r.size, opt)
+}
+
 func getUploadOptions(data []byte) *UploadOptions {
 	if config.UpdateMD5 == true || config.Tier != "none" {
 		opt := &UploadOptions{}
@@ -179,49 +417,100 @@ func getUploadOptions(data []byte) *UploadOptions {
 }
 
 // Workers for delete task
-func deleteWorker(w int) {
+func deleteWorker(ctx context.Context, w int) {
 	defer kalpavriksha.wgWorkers.Done()
+	sched := newWorkerSchedule()
+
 	for job := range kalpavriksha.jobs {
+		if isWindowOver() {
+			continue
+		}
+
+		jobCtx, ok := startJob(ctx, sched, &job)
+		if !ok {
+			continue
+		}
+
 		log.Printf("(%d) %s\n", w, job.path)
 		job.workerId = w
+		atomic.AddInt64(&WaitCount, -1)
 
 		job.status = EJobStatusType.INPROGRESS()
 
-		err := kalpavriksha.storage.Delete(job.path, nil)
+		var opt *DeleteOptions
+		if deleteDirsRecursively() {
+			opt = &DeleteOptions{Recursive: true}
+		} else if job.objtype == EObjectType.DIR() {
+			opt = &DeleteOptions{IsStub: true}
+		}
+
+		opCtx, cancel := withOpTimeout(jobCtx)
+		err := kalpavriksha.storage.Delete(opCtx, job.path, opt)
+		cancel()
+
 		if err != nil {
 			job.status = EJobStatusType.FAILED()
 		} else {
 			job.status = EJobStatusType.SUCCESS()
 		}
 
+		atomic.AddInt64(&WaitCount, 1)
 		kalpavriksha.results <- job
 	}
 }
 
 // worker to change tier of given data set
-func tierWorker(w int) {
+func tierWorker(ctx context.Context, w int) {
 	defer kalpavriksha.wgWorkers.Done()
+	sched := newWorkerSchedule()
+
 	for job := range kalpavriksha.jobs {
+		if isWindowOver() {
+			continue
+		}
+
+		jobCtx, ok := startJob(ctx, sched, &job)
+		if !ok {
+			continue
+		}
+
 		log.Printf("(%d) %s\n", w, job.path)
 		job.workerId = w
+		atomic.AddInt64(&WaitCount, -1)
 
 		job.status = EJobStatusType.INPROGRESS()
 
-		err := kalpavriksha.storage.SetTier(job.path, config.BlobTier)
+		opCtx, cancel := withOpTimeout(jobCtx)
+		err := kalpavriksha.storage.SetTier(opCtx, job.path, config.BlobTier)
+		cancel()
+
 		if err != nil {
 			job.status = EJobStatusType.FAILED()
 		} else {
 			job.status = EJobStatusType.SUCCESS()
 		}
 
+		atomic.AddInt64(&WaitCount, 1)
 		kalpavriksha.results <- job
 	}
 }
 
 // Workers for delete task
-func createStubWorker(w int) {
+func createStubWorker(ctx context.Context, w int) {
 	defer kalpavriksha.wgWorkers.Done()
-	for job := range kalpavriksha.jobs {
+	for {
+		// Job queue is never closed on stop as directories found by other workers may still be pushed to it
+		var job workItem
+		var ok bool
+		select {
+		case job, ok = <-kalpavriksha.jobs:
+			if !ok {
+				return
+			}
+		case <-kalpavriksha.stop.Done():
+			return
+		}
+
 		atomic.AddInt64(&WaitCount, -1)
 
 		job.workerId = w
@@ -232,8 +521,11 @@ func createStubWorker(w int) {
 
 		listCnt := uint64(0)
 		// Iterate blob prefixes
-		for pager.More() {
-			resp, err := pager.NextPage(context.TODO())
+		for pager.More() && !isStopped() {
+			opCtx, cancel := withOpTimeout(ctx)
+			resp, err := pager.NextPage(opCtx)
+			cancel()
+
 			if err == nil {
 				listCnt += uint64(len(resp.Segment.BlobItems))
 				if listCnt > 100000 {
@@ -255,7 +547,9 @@ func createStubWorker(w int) {
 
 					// Get properties of directory
 					if config.CreateStub {
-						err = kalpavriksha.storage.CreateStub(dirPath)
+						opCtx, cancel := withOpTimeout(ctx)
+						err = kalpavriksha.storage.CreateStub(opCtx, dirPath)
+						cancel()
 						if err == nil {
 							log.Printf("(%d) Stub creatd for %s", job.workerId, dirPath)
 						} else if bloberror.HasCode(err, bloberror.BlobAlreadyExists) {
@@ -264,7 +558,9 @@ func createStubWorker(w int) {
 							log.Printf("(%d) Failed to create stub unknown error : %s\n", job.workerId, err.Error())
 						}
 					} else if config.DeleteStub {
-						err = kalpavriksha.storage.Delete(dirPath, nil)
+						opCtx, cancel := withOpTimeout(ctx)
+						err = kalpavriksha.storage.Delete(opCtx, dirPath, &DeleteOptions{IsStub: true})
+						cancel()
 						if err == nil {
 							log.Printf("(%d) Stub deleted for %s", job.workerId, dirPath)
 						}
@@ -284,15 +580,18 @@ func createStubWorker(w int) {
 
 					// Insert this directory for further iteration to main queue
 					go func() {
-						kalpavriksha.jobs <- workItem{
+						select {
+						case kalpavriksha.jobs <- workItem{
 							path:    dirPath + "/",
 							objtype: EObjectType.DIR(),
 							status:  EJobStatusType.WAIT(),
+						}:
+						case <-kalpavriksha.stop.Done():
 						}
 					}()
 				}
 			} else {
-				log.Printf("(%d) Failed to get list of blobs %s, Marker : %s\n", job.workerId, job.path, *resp.NextMarker)
+				log.Printf("(%d) Failed to get list of blobs %s (%s)\n", job.workerId, job.path, err.Error())
 				time.Sleep(5 * time.Second)
 			}
 		}